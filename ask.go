@@ -0,0 +1,44 @@
+package actor
+
+import "context"
+
+// Request is sent to actor by Ask, handler replies by Respond
+type Request struct {
+	Message interface{}
+	reply   chan interface{}
+}
+
+// Respond replies to Ask, only the first reply is delivered
+//
+// returns false if request is replied already.
+func (r *Request) Respond(v interface{}) bool {
+	select {
+	case r.reply <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// Ask sends msg wrapped in *Request to act, blocks until handler replies by
+// Respond
+//
+// Request is sent by SendContext, thus handler receives *Envelope carries
+// *Request as Message.
+//
+// returns ctx.Err() if ctx is done before reply, set ctx deadline to bound
+// the wait.
+func Ask(ctx context.Context, act Actor, msg interface{}) (interface{}, error) {
+	req := &Request{Message: msg, reply: make(chan interface{}, 1)}
+
+	if err := act.SendContext(ctx, req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case v := <-req.reply:
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,246 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	idb "github.com/vsdmars/actor/internal/db"
+	. "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// default sqlite backup rotate check period
+	defaultRotatePeriod = 30 * time.Second
+	// default backup janitor run period
+	defaultJanitorInterval = time.Hour
+)
+
+type (
+	// BackupStore stores messages backed up by actor
+	//
+	// BackupStore is created per actor instance by BackupFactory.
+	BackupStore interface {
+		// Start records actor's start time
+		Start(startTime time.Time) error
+		// Insert stores backed up message
+		Insert(msg string) error
+		// Stop records actor's end time
+		Stop(endTime time.Time) error
+		// Close releases store resource, called after Stop
+		Close()
+	}
+
+	// SnapshotStore is implemented by BackupStore supports actor snapshots
+	SnapshotStore interface {
+		// SaveSnapshot stores serialized state, preserves latest keep
+		// snapshots if keep > 0
+		SaveSnapshot(codec string, state []byte, keep int) error
+		// LoadLatestSnapshot returns the latest snapshot stored by actor
+		// instances with the same name
+		LoadLatestSnapshot() (codec string, state []byte, err error)
+	}
+
+	// BackupConfig configures sqlite backup
+	BackupConfig struct {
+		// Dir contains sqlitedb and sqlitedb_rotate directories,
+		// empty: working directory
+		Dir string
+		// RotatePeriod is the period checks rotation, <= 0: 30 seconds
+		RotatePeriod time.Duration
+	}
+
+	// RetentionPolicy selects sqlite backup files removed by the janitor
+	//
+	// zero value removes nothing
+	RetentionPolicy struct {
+		// rotated backups older than MaxAge, and backups of actors ended
+		// longer than MaxAge if RemoveEnded, are removed, 0: unlimited
+		MaxAge time.Duration
+		// RemoveEnded removes live backups of actors ended longer than
+		// MaxAge, and of crashed actors, which are not running and did not
+		// end, not written longer than MaxAge. Live backup also holds
+		// snapshots, durable mailbox, dead letters, dedup ids and outbox of
+		// the actor, which are recovered by actors with the same name,
+		// backups with pending mailbox or outbox messages are kept.
+		RemoveEnded bool
+		// oldest rotated backups are removed while total backup size
+		// exceeds MaxTotalBytes, 0: unlimited
+		MaxTotalBytes int64
+		// rotated backups preserved per actor instance, oldest are removed,
+		// 0: unlimited
+		MaxRotated int
+	}
+
+	// BackupFactory creates BackupStore for actor instance
+	//
+	// ctx: actor's context
+	//
+	// name: actor's name
+	//
+	// uuid: actor's uuid
+	//
+	// rotate: == 0: backup without rotation, > 0: backup with rotation rows
+	BackupFactory func(
+		ctx context.Context,
+		name, uuid string,
+		rotate int,
+	) (BackupStore, error)
+)
+
+var (
+	backupLock    sync.RWMutex
+	backupFactory BackupFactory = SqliteBackup
+	rotatePeriod                = defaultRotatePeriod
+)
+
+// SetBackupConfig configures sqlite backup
+//
+// applies to actors created afterwards
+func SetBackupConfig(cfg BackupConfig) {
+	defer backupLock.Unlock()
+	backupLock.Lock()
+
+	idb.SetRoot(cfg.Dir)
+
+	rotatePeriod = cfg.RotatePeriod
+	if rotatePeriod <= 0 {
+		rotatePeriod = defaultRotatePeriod
+	}
+}
+
+func getRotatePeriod() time.Duration {
+	defer backupLock.RUnlock()
+	backupLock.RLock()
+
+	return rotatePeriod
+}
+
+// SetBackup sets the BackupFactory used by actors without WithBackup option
+//
+// reset to SqliteBackup by passing in nil
+func SetBackup(f BackupFactory) {
+	defer backupLock.Unlock()
+	backupLock.Lock()
+
+	if f == nil {
+		f = SqliteBackup
+	}
+
+	backupFactory = f
+}
+
+func getBackup() BackupFactory {
+	defer backupLock.RUnlock()
+	backupLock.RLock()
+
+	return backupFactory
+}
+
+// SqliteBackup creates sqlite BackupStore
+//
+// sqlite backup requires build tag 'database', returns ErrNoSqlite otherwise
+func SqliteBackup(
+	ctx context.Context,
+	name, uuid string,
+	rotate int,
+) (BackupStore, error) {
+	s, err := idb.NewSqlite(
+		ctx,
+		name,
+		uuid,
+		idb.DELETE, // sqlite journal mode
+		idb.SHARED, // sqlite cache mode
+		rotate,     // rotate records
+		getRotatePeriod(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// CleanBackup removes sqlite backup files selected by policy
+//
+// backups of running actors are never removed
+//
+// returns removed backup files
+func CleanBackup(ctx context.Context, policy RetentionPolicy) ([]string, error) {
+	running := make(map[string]bool)
+
+	regActor.rwLock.RLock()
+	for uuid := range regActor.uuidActor {
+		running[uuid] = true
+	}
+	regActor.rwLock.RUnlock()
+
+	return idb.Clean(ctx, idb.Retention{
+		MaxAge:        policy.MaxAge,
+		MaxTotalBytes: policy.MaxTotalBytes,
+		MaxRotated:    policy.MaxRotated,
+		RemoveEnded:   policy.RemoveEnded,
+		Running:       running,
+	})
+}
+
+// StartBackupJanitor enforces retention policy on sqlite backup
+//
+// The janitor runs CleanBackup every interval until ctx is cancelled,
+// interval <= 0 runs every hour.
+// returns the error of the first run, e.g. ErrNoSqlite, janitor is not
+// started on error.
+func StartBackupJanitor(
+	ctx context.Context,
+	interval time.Duration,
+	policy RetentionPolicy,
+) error {
+	clean := func() error {
+		removed, err := CleanBackup(ctx, policy)
+		if err != nil {
+			GetLog().Error(
+				"backup janitor error",
+				zap.String("service", serviceName),
+				zap.String("error", err.Error()),
+			)
+
+			return err
+		}
+
+		if len(removed) > 0 {
+			GetLog().Info(
+				"backup janitor removed files",
+				zap.String("service", serviceName),
+				zap.Strings("files", removed),
+			)
+		}
+
+		return nil
+	}
+
+	if err := clean(); err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				clean()
+			}
+		}
+	}()
+
+	return nil
+}
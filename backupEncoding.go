@@ -0,0 +1,200 @@
+package actor
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+)
+
+// encoded backup message: "\x00abk1:<flags>:<key id>:<base64 payload>"
+//
+// payload is flate compressed if flags contains 'z', then sealed with
+// AES-GCM if flags contains 'e' as <nonce><ciphertext>. The header is
+// authenticated as additional data.
+const (
+	encodingMagic    = "\x00abk1:"
+	encodingCompress = 'z'
+	encodingEncrypt  = 'e'
+)
+
+type (
+	// KeyProvider provides AES keys for backup message encryption
+	//
+	// Keys are identified by key id, which is stored along with the
+	// encrypted message. Rotate keys by changing the current key while
+	// keeping previous keys available for decryption.
+	KeyProvider interface {
+		// CurrentKey returns key id and key encrypts new messages
+		CurrentKey() (id string, key []byte, err error)
+		// Key returns key by key id
+		Key(id string) ([]byte, error)
+	}
+
+	// StaticKeys is KeyProvider holds a fixed key set
+	//
+	// keys must be 16, 24 or 32 bytes for AES-128, AES-192 or AES-256
+	StaticKeys struct {
+		Current string            // key id encrypts new messages
+		Keys    map[string][]byte // key id -> key
+	}
+
+	// BackupEncoding transforms backed up message payload
+	//
+	// Encoded messages are decoded by BackupReader transparently, and are
+	// copied as is by backup rotation.
+	BackupEncoding struct {
+		Compress bool        // flate compress message
+		Keys     KeyProvider // encrypt message with AES-GCM, nil: plaintext
+	}
+)
+
+// CurrentKey returns the current key
+func (k StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+// Key returns key by key id
+func (k StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, ErrBackupKey
+	}
+
+	return key, nil
+}
+
+func (e BackupEncoding) enabled() bool {
+	return e.Compress || e.Keys != nil
+}
+
+// encode returns encoded message
+func (e BackupEncoding) encode(msg string) (string, error) {
+	if !e.enabled() {
+		return msg, nil
+	}
+
+	var flags, keyID string
+	data := []byte(msg)
+
+	if e.Compress {
+		var buf bytes.Buffer
+
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		if _, err := w.Write(data); err != nil {
+			return "", err
+		}
+
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+
+		flags += string(encodingCompress)
+		data = buf.Bytes()
+	}
+
+	if e.Keys != nil {
+		id, key, err := e.Keys.CurrentKey()
+		if err != nil {
+			return "", err
+		}
+
+		flags += string(encodingEncrypt)
+		keyID = id
+
+		gcm, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return "", err
+		}
+
+		data = gcm.Seal(nonce, nonce, data, []byte(encodingHeader(flags, keyID)))
+	}
+
+	return encodingHeader(flags, keyID) + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func encodingHeader(flags, keyID string) string {
+	return encodingMagic + flags + ":" + keyID + ":"
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrBackupKey
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// DecodeBackupMessage decodes message encoded by BackupEncoding
+//
+// plain message is returned as is, keys is required for encrypted message
+func DecodeBackupMessage(msg string, keys KeyProvider) (string, error) {
+	if !strings.HasPrefix(msg, encodingMagic) {
+		return msg, nil
+	}
+
+	// flags, key id, payload
+	parts := strings.SplitN(msg[len(encodingMagic):], ":", 3)
+	if len(parts) != 3 {
+		return "", ErrBackupEncoding
+	}
+
+	flags, keyID := parts[0], parts[1]
+
+	data, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrBackupEncoding
+	}
+
+	if strings.IndexByte(flags, encodingEncrypt) >= 0 {
+		if keys == nil {
+			return "", ErrBackupKey
+		}
+
+		key, err := keys.Key(keyID)
+		if err != nil {
+			return "", err
+		}
+
+		gcm, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+
+		if len(data) < gcm.NonceSize() {
+			return "", ErrBackupEncoding
+		}
+
+		data, err = gcm.Open(
+			nil,
+			data[:gcm.NonceSize()],
+			data[gcm.NonceSize():],
+			[]byte(encodingHeader(flags, keyID)),
+		)
+		if err != nil {
+			return "", ErrBackupKey
+		}
+	}
+
+	if strings.IndexByte(flags, encodingCompress) >= 0 {
+		r := flate.NewReader(bytes.NewReader(data))
+		defer r.Close()
+
+		if data, err = io.ReadAll(r); err != nil {
+			return "", ErrBackupEncoding
+		}
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,141 @@
+package actor
+
+import (
+	"context"
+	"time"
+
+	idb "github.com/vsdmars/actor/internal/db"
+)
+
+type (
+	// BackupRecord is a message backed up by actor's Backup
+	BackupRecord struct {
+		UUID    string    // actor uuid
+		Seq     int64     // message sequence, ordered across rotated backups
+		Time    time.Time // message backup time
+		Message string    // backed up message
+		File    string    // backup file stores the message
+	}
+
+	// BackupFilter selects backed up messages, zero value selects all
+	BackupFilter struct {
+		From    time.Time // zero: unbounded
+		To      time.Time // zero: unbounded
+		FromSeq int64     // 0: unbounded
+		ToSeq   int64     // 0: unbounded
+	}
+
+	// BackupReader reads messages backed up by actor
+	//
+	// Messages are read across the live backup and all rotated backups
+	// in order.
+	BackupReader struct {
+		name   string
+		uuid   string
+		filter BackupFilter
+		keys   KeyProvider
+		dir    string // FileBackup directory, empty: sqlite backup
+	}
+)
+
+// NewBackupReader returns BackupReader reads actor's backed up messages
+//
+// name: actor name
+//
+// uuid: actor uuid, empty string reads all actor instances with the name
+// ordered by actor start time
+//
+// filter: selects messages by time range and sequence
+func NewBackupReader(name, uuid string, filter BackupFilter) *BackupReader {
+	return &BackupReader{
+		name:   name,
+		uuid:   uuid,
+		filter: filter,
+	}
+}
+
+// WithKeys sets KeyProvider decrypts messages backed up with BackupEncoding
+//
+// compressed messages are decoded without keys
+func (r *BackupReader) WithKeys(keys KeyProvider) *BackupReader {
+	r.keys = keys
+	return r
+}
+
+// WithFileBackup reads messages backed up by FileBackup under dir instead of
+// sqlite backup
+func (r *BackupReader) WithFileBackup(dir string) *BackupReader {
+	r.dir = dir
+	return r
+}
+
+// Each calls fn for each backed up message in order
+//
+// encoded messages are decoded, returns ErrBackupKey if an encrypted message
+// can not be decrypted, ErrBackupCorrupt if a file backup record is
+// corrupted.
+//
+// iteration stops and returns the error if fn returns error
+func (r *BackupReader) Each(ctx context.Context, fn func(BackupRecord) error) error {
+	if r.dir != "" {
+		return readFileBackup(
+			ctx,
+			r.dir,
+			r.name,
+			r.uuid,
+			r.filter,
+			func(id string, seq int64, t time.Time, message, file string) error {
+				msg, err := DecodeBackupMessage(message, r.keys)
+				if err != nil {
+					return err
+				}
+
+				return fn(BackupRecord{
+					UUID:    id,
+					Seq:     seq,
+					Time:    t,
+					Message: msg,
+					File:    file,
+				})
+			},
+		)
+	}
+
+	return idb.ReadBackup(
+		ctx,
+		r.name,
+		r.uuid,
+		idb.Filter{
+			From:    r.filter.From,
+			To:      r.filter.To,
+			FromSeq: r.filter.FromSeq,
+			ToSeq:   r.filter.ToSeq,
+		},
+		func(rec idb.Record) error {
+			msg, err := DecodeBackupMessage(rec.Message, r.keys)
+			if err != nil {
+				return err
+			}
+
+			return fn(BackupRecord{
+				UUID:    rec.UUID,
+				Seq:     rec.Seq,
+				Time:    rec.Time,
+				Message: msg,
+				File:    rec.File,
+			})
+		},
+	)
+}
+
+// ReadAll returns all backed up messages in order
+func (r *BackupReader) ReadAll(ctx context.Context) ([]BackupRecord, error) {
+	var records []BackupRecord
+
+	err := r.Each(ctx, func(rec BackupRecord) error {
+		records = append(records, rec)
+		return nil
+	})
+
+	return records, err
+}
@@ -0,0 +1,425 @@
+package actor_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func waitDeregister(t *testing.T, name string) {
+	for idx := 0; idx < 100; idx++ {
+		if _, err := actor.Get(name); err == actor.ErrRetrieveActor {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal(actorNotCleanup)
+}
+
+func TestMemoryBackup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := actor.NewMemoryBackup()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 3; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+		}
+
+		records := mem.Records(tc.name, "")
+		if len(records) != 3 {
+			t.Fatalf("expecting: 3 records, receiving: %d", len(records))
+		}
+
+		for idx, rec := range records {
+			if rec.Message != fmt.Sprintf("message %d", idx+1) {
+				t.Errorf("expecting: message %d, receiving: %s", idx+1, rec.Message)
+			}
+		}
+
+		if err := act.SaveSnapshot(map[string]int{"count": 3}); err != nil {
+			t.Fatal(err)
+		}
+
+		state := make(map[string]int)
+		if err := act.LoadLatestSnapshot(&state); err != nil {
+			t.Fatal(err)
+		}
+
+		if state["count"] != 3 {
+			t.Errorf("expecting count: 3, receiving: %d", state["count"])
+		}
+
+		cancel()
+		waitDeregister(t, tc.name)
+
+		if !mem.Stopped(act.UUID()) {
+			t.Error("expecting actor end time recorded")
+		}
+	}
+}
+
+func TestSetBackup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := actor.NewMemoryBackup()
+	actor.SetBackup(mem.Store)
+	defer actor.SetBackup(nil)
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Backup("system wide backup")
+
+		if records := mem.Records(tc.name, act.UUID()); len(records) != 1 {
+			t.Errorf("expecting: 1 record, receiving: %d", len(records))
+		}
+	}
+}
+
+func TestFileBackup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "actor_file_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// rotate segment every 2 records
+	for _, tc := range createTestCase(1, 0, 2) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(actor.FileBackup(dir, 0)),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 5; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+		}
+
+		if err := act.SaveSnapshot(1); err != actor.ErrSnapshotUnsupported {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrSnapshotUnsupported, err)
+		}
+
+		segs, err := filepath.Glob(filepath.Join(dir, tc.name+"_*.seg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// start entry may not be written yet
+		if len(segs) < 3 {
+			t.Errorf("expecting: >= 3 segments, receiving: %d", len(segs))
+		}
+
+		records, err := actor.NewBackupReader(tc.name, act.UUID(), actor.BackupFilter{}).
+			WithFileBackup(dir).
+			ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 5 || records[4].Message != "message 5" || records[4].Seq != 5 {
+			t.Errorf("expecting: 5 messages in order, receiving: %v", records)
+		}
+
+		records, err = actor.NewBackupReader(tc.name, "", actor.BackupFilter{FromSeq: 4}).
+			WithFileBackup(dir).
+			ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 2 {
+			t.Errorf("expecting: 2 messages, receiving: %d", len(records))
+		}
+	}
+}
+
+func TestFileBackupRecover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "actor_file_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tc := createTestCase(1, 0, 0)[0]
+
+	newActor := func(ctx context.Context) actor.Actor {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(actor.FileBackup(dir, 0)),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		return act
+	}
+
+	actCtx, actCancel := context.WithCancel(ctx)
+	act := newActor(actCtx)
+
+	for idx := 1; idx <= 3; idx++ {
+		act.Backup(fmt.Sprintf("message %d", idx))
+	}
+
+	actCancel()
+	waitDeregister(t, tc.name)
+
+	// torn record left by a crash
+	segs, err := filepath.Glob(filepath.Join(dir, tc.name+"_*.seg"))
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("expecting: 1 segment, receiving: %d, %v", len(segs), err)
+	}
+
+	f, err := os.OpenFile(segs[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 64, 1, 2})
+	f.Close()
+
+	reader := actor.NewBackupReader(tc.name, "", actor.BackupFilter{}).WithFileBackup(dir)
+
+	if _, err := reader.ReadAll(ctx); !errors.Is(err, actor.ErrBackupCorrupt) {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrBackupCorrupt, err)
+	}
+
+	// actor with the same name repairs the crashed instance's log
+	act = newActor(ctx)
+	act.Backup("message 4")
+
+	records, err := reader.ReadAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 4 || records[3].Message != "message 4" {
+		t.Errorf("expecting: 4 messages in order, receiving: %v", records)
+	}
+}
+
+func TestBatchBackup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := actor.NewMemoryBackup()
+	burst := 1000
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+			actor.WithBatchBackup(64, time.Hour),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 0; idx < burst; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+		}
+
+		if err := act.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		records := mem.Records(tc.name, act.UUID())
+		if len(records) != burst {
+			t.Fatalf("expecting: %d records, receiving: %d", burst, len(records))
+		}
+
+		for idx, rec := range records {
+			if rec.Message != fmt.Sprintf("message %d", idx) {
+				t.Fatalf("expecting: message %d, receiving: %s", idx, rec.Message)
+			}
+		}
+
+		// queued messages are written on actor stop
+		act.Backup("last message")
+		cancel()
+		waitDeregister(t, tc.name)
+
+		for idx := 0; idx < 100 && !mem.Stopped(act.UUID()); idx++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if records := mem.Records(tc.name, act.UUID()); len(records) != burst+1 {
+			t.Errorf("expecting: %d records, receiving: %d", burst+1, len(records))
+		}
+
+		if err := act.Flush(); err != actor.ErrBackupClosed {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrBackupClosed, err)
+		}
+	}
+}
+
+func TestBackupEncoding(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := actor.NewMemoryBackup()
+	keys := actor.StaticKeys{
+		Current: "k1",
+		Keys: map[string][]byte{
+			"k1": []byte("0123456789abcdef"),
+			"k2": []byte("0123456789abcdef0123456789abcdef"),
+		},
+	}
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+			actor.WithBackupEncoding(
+				actor.BackupEncoding{Compress: true, Keys: &keys}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Backup("customer data")
+
+		// rotate key, previous key still decrypts
+		keys.Current = "k2"
+		act.Backup("customer data")
+
+		records := mem.Records(tc.name, act.UUID())
+		if len(records) != 2 {
+			t.Fatalf("expecting: 2 records, receiving: %d", len(records))
+		}
+
+		for _, rec := range records {
+			if strings.Contains(rec.Message, "customer") {
+				t.Errorf("expecting encrypted message, receiving: %q", rec.Message)
+			}
+
+			msg, err := actor.DecodeBackupMessage(rec.Message, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if msg != "customer data" {
+				t.Errorf("expecting: customer data, receiving: %s", msg)
+			}
+
+			if _, err := actor.DecodeBackupMessage(rec.Message, nil); err != actor.ErrBackupKey {
+				t.Errorf("expecting: %v, receiving: %v", actor.ErrBackupKey, err)
+			}
+		}
+
+		if records[0].Message[:12] == records[1].Message[:12] {
+			t.Error("expecting different key id after rotation")
+		}
+	}
+}
+
+func TestBackupCompression(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mem := actor.NewMemoryBackup()
+	plain := strings.Repeat("compressible ", 100)
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+			actor.WithBackupEncoding(actor.BackupEncoding{Compress: true}),
+			actor.WithBatchBackup(0, 0),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Backup(plain)
+
+		if err := act.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		records := mem.Records(tc.name, act.UUID())
+		if len(records) != 1 {
+			t.Fatalf("expecting: 1 record, receiving: %d", len(records))
+		}
+
+		if len(records[0].Message) >= len(plain) {
+			t.Errorf("expecting compressed message, receiving: %d bytes", len(records[0].Message))
+		}
+
+		// compressed message decodes without keys
+		msg, err := actor.DecodeBackupMessage(records[0].Message, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if msg != plain {
+			t.Errorf("expecting: %q, receiving: %q", plain, msg)
+		}
+
+		// plain message is returned as is
+		if msg, _ := actor.DecodeBackupMessage(plain, nil); msg != plain {
+			t.Errorf("expecting plain message, receiving: %q", msg)
+		}
+	}
+}
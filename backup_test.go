@@ -0,0 +1,601 @@
+// +build database
+
+package actor_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestBackupReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 10; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+		}
+
+		records, err := actor.NewBackupReader(
+			tc.name, "", actor.BackupFilter{}).ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 10 {
+			t.Fatalf("expecting: 10 records, receiving: %d", len(records))
+		}
+
+		for idx, rec := range records {
+			if rec.Message != fmt.Sprintf("message %d", idx+1) {
+				t.Errorf("expecting: message %d, receiving: %s", idx+1, rec.Message)
+			}
+
+			if rec.UUID != act.UUID() {
+				t.Errorf("expecting uuid: %s, receiving: %s", act.UUID(), rec.UUID)
+			}
+		}
+
+		records, err = actor.NewBackupReader(
+			tc.name,
+			act.UUID(),
+			actor.BackupFilter{FromSeq: 3, ToSeq: 5},
+		).ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 3 || records[0].Seq != 3 {
+			t.Errorf("expecting: 3 records from seq 3, receiving: %v", records)
+		}
+
+		records, err = actor.NewBackupReader(
+			tc.name,
+			"",
+			actor.BackupFilter{From: time.Now().Add(time.Hour)},
+		).ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 0 {
+			t.Errorf("expecting: 0 records, receiving: %d", len(records))
+		}
+	}
+}
+
+func TestBackupRotateAndClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{
+		Dir:          dir,
+		RotatePeriod: 50 * time.Millisecond,
+	})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// rotate every 2 rows
+	for _, tc := range createTestCase(1, 0, 2) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 10; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+
+		rotated, _ := filepath.Glob(filepath.Join(dir, "sqlitedb_rotate", "*.db"))
+		if len(rotated) < 2 {
+			t.Fatalf("expecting: >= 2 rotated files, receiving: %d", len(rotated))
+		}
+
+		records, err := actor.NewBackupReader(
+			tc.name, "", actor.BackupFilter{}).ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 10 {
+			t.Fatalf("expecting: 10 records, receiving: %d", len(records))
+		}
+
+		for idx, rec := range records {
+			if rec.Seq != int64(idx+1) {
+				t.Errorf("expecting seq: %d, receiving: %d", idx+1, rec.Seq)
+			}
+		}
+
+		removed, err := actor.CleanBackup(
+			ctx, actor.RetentionPolicy{MaxRotated: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(removed) != len(rotated)-1 {
+			t.Errorf("expecting: %d removed, receiving: %d", len(rotated)-1, len(removed))
+		}
+
+		cancel()
+		waitDeregister(t, tc.name)
+
+		// live backup of ended actor is kept without RemoveEnded
+		removed, err = actor.CleanBackup(
+			context.Background(), actor.RetentionPolicy{MaxAge: time.Nanosecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(removed) != 1 || !strings.Contains(removed[0], "sqlitedb_rotate") {
+			t.Errorf("expecting: rotated backup removed, receiving: %v", removed)
+		}
+
+		// actor ended, live backup removed once end time is recorded
+		removed = nil
+		for idx := 0; idx < 100 && len(removed) == 0; idx++ {
+			time.Sleep(10 * time.Millisecond)
+
+			removed, err = actor.CleanBackup(
+				context.Background(),
+				actor.RetentionPolicy{MaxAge: time.Nanosecond, RemoveEnded: true},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(removed) != 1 {
+			t.Errorf("expecting: 1 removed, receiving: %v", removed)
+		}
+	}
+}
+
+func TestBackupReaderEncoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_backup_encoding")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{
+		Dir:          dir,
+		RotatePeriod: 50 * time.Millisecond,
+	})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := actor.StaticKeys{
+		Current: "k1",
+		Keys:    map[string][]byte{"k1": []byte("0123456789abcdef")},
+	}
+
+	// rotate every 2 rows
+	for _, tc := range createTestCase(1, 0, 2) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackupEncoding(
+				actor.BackupEncoding{Compress: true, Keys: keys}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 6; idx++ {
+			act.Backup(fmt.Sprintf("message %d", idx))
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		time.Sleep(200 * time.Millisecond)
+
+		reader := actor.NewBackupReader(tc.name, "", actor.BackupFilter{})
+
+		if _, err := reader.ReadAll(ctx); err != actor.ErrBackupKey {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrBackupKey, err)
+		}
+
+		records, err := reader.WithKeys(keys).ReadAll(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(records) != 6 {
+			t.Fatalf("expecting: 6 records, receiving: %d", len(records))
+		}
+
+		for idx, rec := range records {
+			if rec.Message != fmt.Sprintf("message %d", idx+1) {
+				t.Errorf("expecting: message %d, receiving: %s", idx+1, rec.Message)
+			}
+		}
+	}
+}
+
+func TestSqliteDurableMailbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_mailbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	for _, tc := range createTestCase(1, 10, 0) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDurableMailbox(2),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Send("acked")
+		act.Send("redelivered")
+
+		receiveEnvelope(t, act).Ack()
+
+		cancel()
+		waitDeregister(t, tc.name)
+
+		for attempt := 2; attempt <= 3; attempt++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			act, err := actor.NewActor(
+				ctx,
+				tc.name,
+				tc.buffer,
+				func(act actor.Actor) { <-act.Done() },
+				tc.backup,
+				actor.WithDurableMailbox(2),
+			)
+			if err != nil {
+				t.Fatal(createActorErr)
+			}
+
+			if attempt == 3 {
+				// attempts reached, message is moved into dead letter queue
+				dead, err := act.DeadLetters()
+				for idx := 0; idx < 100 && err == nil && len(dead) == 0; idx++ {
+					time.Sleep(10 * time.Millisecond)
+					dead, err = act.DeadLetters()
+				}
+
+				if err != nil || len(dead) != 1 || dead[0].Message != "redelivered" {
+					t.Errorf("expecting: 1 dead letter, receiving: %v %v", dead, err)
+				}
+
+				break
+			}
+
+			env := receiveEnvelope(t, act)
+			if env.Message != "redelivered" || env.Attempt != attempt {
+				t.Errorf("expecting: redelivered attempt %d, receiving: %v %d", attempt, env.Message, env.Attempt)
+			}
+
+			cancel()
+			waitDeregister(t, tc.name)
+		}
+	}
+}
+
+func TestCleanKeepsPendingMailbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_clean_pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	for _, tc := range createTestCase(1, 10, 0) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDurableMailbox(0),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Send("pending")
+
+		cancel()
+		waitDeregister(t, tc.name)
+
+		// live backup holding pending message survives once end time is
+		// recorded
+		for idx := 0; idx < 20; idx++ {
+			time.Sleep(10 * time.Millisecond)
+
+			removed, err := actor.CleanBackup(
+				context.Background(),
+				actor.RetentionPolicy{MaxAge: time.Nanosecond, RemoveEnded: true},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(removed) != 0 {
+				t.Fatalf("expecting: 0 removed, receiving: %v", removed)
+			}
+		}
+	}
+}
+
+func TestCleanCrashedActor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_clean_crashed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Backup("message")
+
+		// db of crashed instance has no end time
+		live := filepath.Join(dir, "sqlitedb", tc.name+"_"+act.UUID()+".db")
+		crashed := filepath.Join(
+			dir, "sqlitedb", tc.name+"_00000000-0000-0000-0000-000000000001.db")
+
+		data, err := ioutil.ReadFile(live)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(crashed, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		old := time.Now().Add(-2 * time.Hour)
+		for _, file := range []string{live, crashed} {
+			if err := os.Chtimes(file, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// running actor is kept although not written longer than MaxAge
+		policy := actor.RetentionPolicy{MaxAge: time.Hour, RemoveEnded: true}
+		if err := actor.StartBackupJanitor(ctx, 0, policy); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(crashed); !os.IsNotExist(err) {
+			t.Errorf("expecting: %s removed, receiving: %v", crashed, err)
+		}
+
+		if _, err := os.Stat(live); err != nil {
+			t.Errorf("expecting: %s kept, receiving: %v", live, err)
+		}
+	}
+}
+
+func TestSqlitePersistedDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	env := actor.NewEnvelope("once")
+
+	for _, tc := range createTestCase(1, 10, 0) {
+		for run := 0; run < 2; run++ {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			act, err := actor.NewActor(
+				ctx,
+				tc.name,
+				tc.buffer,
+				func(act actor.Actor) { <-act.Done() },
+				tc.backup,
+				actor.WithDedup(actor.DedupConfig{Persist: true}),
+			)
+			if err != nil {
+				cancel()
+				t.Fatal(createActorErr)
+			}
+
+			act.Send(env)
+
+			expect := 1 - run // dropped after restart
+			if cnt := receiveCount(act, 50*time.Millisecond); cnt != expect {
+				t.Errorf("run %d expecting: %d message, receiving: %d", run, expect, cnt)
+			}
+
+			cancel()
+			waitDeregister(t, tc.name)
+		}
+	}
+}
+
+func TestSqliteOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	cases := createTestCase(2, 0, 0)
+	sender, receiver := cases[0], cases[1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	act, err := actor.NewActor(
+		ctx,
+		sender.name,
+		sender.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		sender.backup,
+		actor.WithOutbox(actor.RelayConfig{}),
+	)
+	if err != nil {
+		cancel()
+		t.Fatal(createActorErr)
+	}
+
+	// receiver is not running, delivery fails
+	err = act.Commit(
+		map[string]int{"count": 1},
+		actor.OutboxMessage{Target: receiver.name, Message: "hello"},
+	)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	cancel()
+	waitDeregister(t, sender.name)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	recv, err := actor.NewActor(
+		ctx,
+		receiver.name,
+		receiver.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		-1,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	act, err = actor.NewActor(
+		ctx,
+		sender.name,
+		sender.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		sender.backup,
+		actor.WithOutbox(actor.RelayConfig{}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	state := make(map[string]int)
+	if err := act.LoadLatestSnapshot(&state); err != nil || state["count"] != 1 {
+		t.Errorf("expecting count: 1, receiving: %v %v", state, err)
+	}
+
+	select {
+	case msg := <-recv.Receive():
+		if env := msg.(*actor.Envelope); env.Message != "hello" {
+			t.Errorf("expecting: hello, receiving: %v", env.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+}
+
+func benchmarkBackup(b *testing.B, opts ...actor.Option) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			opts...,
+		)
+		if err != nil {
+			b.Fatal(createActorErr)
+		}
+
+		b.ResetTimer()
+
+		for idx := 0; idx < b.N; idx++ {
+			act.Backup("i am the lead role!")
+		}
+
+		if err := act.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBackup(b *testing.B) {
+	benchmarkBackup(b)
+}
+
+func BenchmarkBatchBackup(b *testing.B) {
+	benchmarkBackup(b, actor.WithBatchBackup(0, 0))
+}
@@ -0,0 +1,213 @@
+package actor
+
+import (
+	"sync"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// default number of messages written per batch
+	defaultBatchSize = 256
+	// default latency bound of a queued message before written
+	defaultBatchLatency = 10 * time.Millisecond
+)
+
+type (
+	// BatchStore is implemented by BackupStore able to insert messages in
+	// a single transaction
+	BatchStore interface {
+		InsertBatch(msgs []string) error
+	}
+
+	// batchRequest is a queued message or a flush request
+	batchRequest struct {
+		msg   string
+		flush chan error // non-nil: flush request
+	}
+
+	// batchWriter is the write-behind buffer of actor's BackupStore
+	//
+	// messages are grouped into batches by count or latency bound.
+	batchWriter struct {
+		rwLock  sync.RWMutex
+		closed  bool
+		name    string
+		uuid    string
+		store   BackupStore
+		size    int
+		latency time.Duration
+		queue   chan batchRequest
+		done    chan struct{}
+		log     l.ServiceLogger
+	}
+)
+
+func newBatchWriter(
+	name, uuid string,
+	store BackupStore,
+	size int,
+	latency time.Duration,
+	log l.ServiceLogger,
+) *batchWriter {
+	if size <= 0 {
+		size = defaultBatchSize
+	}
+
+	if latency <= 0 {
+		latency = defaultBatchLatency
+	}
+
+	w := &batchWriter{
+		name:    name,
+		uuid:    uuid,
+		store:   store,
+		size:    size,
+		latency: latency,
+		queue:   make(chan batchRequest, size),
+		done:    make(chan struct{}),
+		log:     log,
+	}
+
+	go w.run()
+
+	return w
+}
+
+// Insert queues message, blocks while the queue is full
+func (w *batchWriter) Insert(msg string) error {
+	defer w.rwLock.RUnlock()
+	w.rwLock.RLock()
+
+	if w.closed {
+		return ErrBackupClosed
+	}
+
+	w.queue <- batchRequest{msg: msg}
+
+	return nil
+}
+
+// Flush blocks until queued messages are written
+//
+// returns the first write error since last Flush
+func (w *batchWriter) Flush() error {
+	flush := make(chan error, 1)
+
+	w.rwLock.RLock()
+	if w.closed {
+		w.rwLock.RUnlock()
+		return ErrBackupClosed
+	}
+
+	w.queue <- batchRequest{flush: flush}
+	w.rwLock.RUnlock()
+
+	return <-flush
+}
+
+// Close writes queued messages and stops the writer
+func (w *batchWriter) Close() {
+	w.rwLock.Lock()
+	if w.closed {
+		w.rwLock.Unlock()
+		return
+	}
+
+	w.closed = true
+	close(w.queue)
+	w.rwLock.Unlock()
+
+	<-w.done
+}
+
+func (w *batchWriter) run() {
+	defer close(w.done)
+
+	batch := make([]string, 0, w.size)
+	var timeout <-chan time.Time
+	var firstErr error
+
+	write := func() {
+		timeout = nil
+
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := w.insert(batch); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case req, ok := <-w.queue:
+			if !ok {
+				write()
+				return
+			}
+
+			if req.flush != nil {
+				write()
+				req.flush <- firstErr
+				firstErr = nil
+				continue
+			}
+
+			batch = append(batch, req.msg)
+
+			if len(batch) == 1 {
+				timeout = time.After(w.latency)
+			}
+
+			if len(batch) >= w.size {
+				write()
+			}
+		case <-timeout:
+			write()
+		}
+	}
+}
+
+func (w *batchWriter) insert(batch []string) error {
+	var err error
+
+	start := time.Now()
+
+	if bs, ok := w.store.(BatchStore); ok {
+		err = bs.InsertBatch(batch)
+	} else {
+		for _, msg := range batch {
+			if err = w.store.Insert(msg); err != nil {
+				break
+			}
+		}
+	}
+
+	if m := getMetrics(); m != nil {
+		m.Observe(MetricBackupLatency, w.name, time.Since(start).Seconds())
+
+		if err != nil {
+			m.Count(MetricBackupErrors, w.name, 1)
+		}
+	}
+
+	if err != nil {
+		w.log.Error(
+			"backup actor message batch error",
+			zap.String("service", serviceName),
+			zap.String("actor", w.name),
+			zap.String("uuid", w.uuid),
+			zap.Int("messages", len(batch)),
+			zap.String("error", err.Error()),
+		)
+	}
+
+	return err
+}
@@ -0,0 +1,299 @@
+package actor
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// Behavior processes messages of actor created by NewBehaviorActor
+	//
+	// Behavior may implement PreStarter, PostStopper and PreRestarter, hooks
+	// of the initial behavior are invoked by the runtime.
+	Behavior interface {
+		Receive(ctx ActorContext, msg interface{})
+	}
+
+	// BehaviorFunc adapts function to Behavior
+	BehaviorFunc func(ctx ActorContext, msg interface{})
+
+	// ActorContext is passed to Behavior for each message
+	//
+	// ActorContext is done once actor is cancelled, it must not be used
+	// outside of Receive and hooks.
+	ActorContext interface {
+		context.Context
+		// Self returns the actor processing the message
+		Self() Actor
+		// Become pushes b onto behavior stack, b receives following messages
+		Become(b Behavior)
+		// Unbecome pops current behavior, previous behavior receives
+		// following messages, the initial behavior is never popped
+		Unbecome()
+		// Stash defers the message being received until UnstashAll,
+		// returns ErrStashFull once stash reaches WithStashCapacity
+		Stash() error
+		// UnstashAll moves stashed messages in front of the messages not
+		// received yet, in the order they were stashed
+		UnstashAll()
+	}
+
+	// PreStarter is invoked before actor receives the first message
+	//
+	// returned error stops the actor.
+	PreStarter interface {
+		PreStart(ctx ActorContext) error
+	}
+
+	// PostStopper is invoked once actor stops receiving messages
+	PostStopper interface {
+		PostStop(ctx ActorContext)
+	}
+
+	// PreRestarter is invoked once Receive panics
+	//
+	// actor's behavior implements PreRestarter is restarted instead of
+	// stopped, behavior stack is reset to the initial behavior and
+	// PreStart is invoked again. Unprocessed and stashed messages are kept.
+	PreRestarter interface {
+		PreRestart(ctx ActorContext, reason interface{})
+	}
+
+	// behaviorContext runs behavior stack of actor
+	behaviorContext struct {
+		context.Context
+		actor   *localActor
+		stack   []Behavior    // stack[0]: initial behavior
+		pending []interface{} // received messages not processed yet
+		buf     []interface{} // ring mailbox batch buffer
+		current interface{}   // message being received
+		stash   []interface{} // messages deferred by Stash
+	}
+)
+
+// Receive calls f(ctx, msg)
+func (f BehaviorFunc) Receive(ctx ActorContext, msg interface{}) {
+	f(ctx, msg)
+}
+
+// NewBehaviorActor creates actor processes messages by behavior
+//
+// The runtime runs actor's loop, the current behavior of the behavior stack
+// receives messages one at a time. Panic in Receive stops the actor unless
+// behavior implements PreRestarter. Parameters are the same as NewActor.
+func NewBehaviorActor(
+	ctx context.Context,
+	name string,
+	buffer int,
+	behavior Behavior,
+	b int,
+	opts ...Option,
+) (Actor, error) {
+	return NewActor(
+		ctx,
+		name,
+		buffer,
+		func(act Actor) {
+			la := act.(*localActor)
+
+			c := &behaviorContext{
+				Context: la.ctx,
+				actor:   la,
+				stack:   []Behavior{behavior},
+			}
+
+			if la.ring != nil {
+				c.buf = make([]interface{}, 64)
+			}
+
+			c.run()
+		},
+		b,
+		append(opts[:len(opts):len(opts)], func(o *options) {
+			// behavior loop records received metrics
+			o.measured = true
+		})...,
+	)
+}
+
+// Self returns the actor processing the message
+func (c *behaviorContext) Self() Actor {
+	return c.actor
+}
+
+// Become pushes b onto behavior stack
+func (c *behaviorContext) Become(b Behavior) {
+	c.stack = append(c.stack, b)
+}
+
+// Unbecome pops current behavior unless it's the initial behavior
+func (c *behaviorContext) Unbecome() {
+	if len(c.stack) > 1 {
+		c.stack[len(c.stack)-1] = nil
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
+
+// Stash defers the message being received until UnstashAll
+func (c *behaviorContext) Stash() error {
+	if len(c.stash) >= c.actor.stashCap {
+		c.actor.log().Warn(
+			"actor stash full",
+			zap.String("service", serviceName),
+			zap.String("actor", c.actor.name),
+			zap.String("uuid", c.actor.uuid),
+			zap.Int("capacity", c.actor.stashCap),
+		)
+
+		return ErrStashFull
+	}
+
+	c.stash = append(c.stash, c.current)
+
+	return nil
+}
+
+// UnstashAll moves stashed messages in front of pending messages
+func (c *behaviorContext) UnstashAll() {
+	if len(c.stash) == 0 {
+		return
+	}
+
+	c.pending = append(c.stash, c.pending...)
+	c.stash = nil
+}
+
+func (c *behaviorContext) run() {
+	defer c.postStop()
+
+	if !c.preStart() {
+		return
+	}
+
+	for {
+		msg, ok := c.next()
+		if !ok {
+			return
+		}
+
+		if !c.receive(msg) {
+			return
+		}
+	}
+}
+
+// next returns next message, false once actor is cancelled
+func (c *behaviorContext) next() (interface{}, bool) {
+	if len(c.pending) == 0 {
+		if c.buf != nil {
+			n := c.actor.ReceiveBatch(c.buf)
+			if n == 0 {
+				return nil, false
+			}
+
+			c.pending = append(c.pending, c.buf[:n]...)
+			clear(c.buf[:n])
+		} else {
+			select {
+			case <-c.actor.Done():
+				return nil, false
+			case msg := <-c.actor.Receive():
+				return msg, true
+			}
+		}
+	}
+
+	msg := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+
+	return msg, true
+}
+
+// receive passes msg to current behavior, returns false if actor is stopped
+// by panic within restart
+func (c *behaviorContext) receive(msg interface{}) (ok bool) {
+	restarter, restart := c.stack[0].(PreRestarter)
+
+	defer func() {
+		if !restart {
+			return
+		}
+
+		if r := recover(); r != nil {
+			c.actor.reportPanic(r)
+			c.actor.handling.Store((*Envelope)(nil))
+			c.current = nil
+
+			c.actor.log().Warn(
+				"actor restart",
+				zap.String("service", serviceName),
+				zap.String("actor", c.actor.name),
+				zap.String("uuid", c.actor.uuid),
+				zap.Any("reason", r),
+			)
+
+			if m := getMetrics(); m != nil {
+				m.Count(MetricRestarts, c.actor.name, 1)
+			}
+
+			restarter.PreRestart(c, r)
+
+			for idx := 1; idx < len(c.stack); idx++ {
+				c.stack[idx] = nil
+			}
+			c.stack = c.stack[:1]
+
+			ok = c.preStart()
+		}
+	}()
+
+	env, isEnv := msg.(*Envelope)
+	if isEnv {
+		// reported if behavior panics
+		c.actor.handling.Store(env)
+	}
+
+	m := getMetrics()
+	start := c.actor.recordReceive(m)
+
+	c.current = msg
+	c.stack[len(c.stack)-1].Receive(c, msg)
+	c.current = nil
+
+	c.actor.recordHandled(m, start)
+
+	if isEnv {
+		c.actor.handling.Store((*Envelope)(nil))
+	}
+
+	return true
+}
+
+func (c *behaviorContext) preStart() bool {
+	s, ok := c.stack[0].(PreStarter)
+	if !ok {
+		return true
+	}
+
+	if err := s.PreStart(c); err != nil {
+		c.actor.log().Error(
+			"actor pre start error",
+			zap.String("service", serviceName),
+			zap.String("actor", c.actor.name),
+			zap.String("uuid", c.actor.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return false
+	}
+
+	return true
+}
+
+func (c *behaviorContext) postStop() {
+	if s, ok := c.stack[0].(PostStopper); ok {
+		s.PostStop(c)
+	}
+}
@@ -0,0 +1,211 @@
+package actor_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// door is a behavior switches between closed and open behaviors
+type door struct {
+	events  chan string
+	failure error
+}
+
+func (d *door) PreStart(ctx actor.ActorContext) error {
+	d.events <- "pre start"
+	return d.failure
+}
+
+func (d *door) PostStop(ctx actor.ActorContext) {
+	d.events <- "post stop"
+}
+
+func (d *door) PreRestart(ctx actor.ActorContext, reason interface{}) {
+	d.events <- "pre restart " + reason.(string)
+}
+
+func (d *door) Receive(ctx actor.ActorContext, msg interface{}) {
+	switch msg {
+	case "open":
+		d.events <- "opened"
+		ctx.Become(actor.BehaviorFunc(d.open))
+	case "break":
+		panic("broken")
+	default:
+		d.events <- "closed " + msg.(string)
+	}
+}
+
+func (d *door) open(ctx actor.ActorContext, msg interface{}) {
+	switch msg {
+	case "close":
+		d.events <- "closed"
+		ctx.Unbecome()
+	case "break":
+		panic("broken")
+	default:
+		d.events <- "open " + msg.(string)
+	}
+}
+
+func expectEvents(t *testing.T, events chan string, expect ...string) {
+	t.Helper()
+
+	for _, e := range expect {
+		select {
+		case got := <-events:
+			if got != e {
+				t.Fatalf("expecting: %s, receiving: %s", e, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+}
+
+func TestBehavior(t *testing.T) {
+	for _, opts := range [][]actor.Option{nil, {actor.WithRingMailbox()}} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		d := &door{events: make(chan string, 10)}
+
+		tc := createTestCase(1, 10, -1)[0]
+		act, err := actor.NewBehaviorActor(ctx, tc.name, tc.buffer, d, tc.backup, opts...)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for _, msg := range []string{"knock", "open", "knock", "close", "knock"} {
+			act.Send(msg)
+		}
+
+		expectEvents(t, d.events,
+			"pre start", "closed knock", "opened", "open knock", "closed", "closed knock")
+
+		cancel()
+
+		expectEvents(t, d.events, "post stop")
+		waitDeregister(t, tc.name)
+	}
+}
+
+func TestBehaviorRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &door{events: make(chan string, 10)}
+
+	tc := createTestCase(1, 10, -1)[0]
+	act, err := actor.NewBehaviorActor(ctx, tc.name, tc.buffer, d, tc.backup)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	for _, msg := range []string{"open", "break", "knock"} {
+		act.Send(msg)
+	}
+
+	// behavior stack is reset to the initial behavior
+	expectEvents(t, d.events,
+		"pre start", "opened", "pre restart broken", "pre start", "closed knock")
+
+	if _, err := actor.Get(tc.name); err != nil {
+		t.Fatal("expecting: restarted actor remains registered")
+	}
+}
+
+func TestBehaviorPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan string, 10)
+
+	tc := createTestCase(1, 10, -1)[0]
+	act, err := actor.NewBehaviorActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		actor.BehaviorFunc(func(ctx actor.ActorContext, msg interface{}) {
+			if ctx.Self().Name() != tc.name {
+				t.Errorf("expecting: self %s, receiving: %s", tc.name, ctx.Self().Name())
+			}
+
+			events <- msg.(string)
+			panic(msg)
+		}),
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	act.Send("boom")
+
+	// behavior without PreRestarter stops the actor
+	expectEvents(t, events, "boom")
+	waitDeregister(t, tc.name)
+}
+
+func TestBehaviorPreStartError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &door{events: make(chan string, 10), failure: errors.New("not ready")}
+
+	tc := createTestCase(1, 10, -1)[0]
+	if _, err := actor.NewBehaviorActor(ctx, tc.name, tc.buffer, d, tc.backup); err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	expectEvents(t, d.events, "pre start", "post stop")
+	waitDeregister(t, tc.name)
+}
+
+func TestBehaviorStash(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan string, 10)
+
+	serving := actor.BehaviorFunc(func(ctx actor.ActorContext, msg interface{}) {
+		events <- "serve " + msg.(string)
+	})
+
+	// requests are deferred until state is loaded
+	loading := actor.BehaviorFunc(func(ctx actor.ActorContext, msg interface{}) {
+		if msg == "loaded" {
+			ctx.Become(serving)
+			ctx.UnstashAll()
+
+			return
+		}
+
+		if err := ctx.Stash(); err != nil {
+			events <- err.Error()
+		}
+	})
+
+	tc := createTestCase(1, 10, -1)[0]
+	act, err := actor.NewBehaviorActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		loading,
+		tc.backup,
+		actor.WithStashCapacity(2),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	for _, msg := range []string{"a", "b", "c", "loaded", "d"} {
+		act.Send(msg)
+	}
+
+	expectEvents(t, events,
+		actor.ErrStashFull.Error(), "serve a", "serve b", "serve d")
+}
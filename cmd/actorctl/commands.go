@@ -0,0 +1,425 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vsdmars/actor"
+	idb "github.com/vsdmars/actor/internal/db"
+)
+
+const (
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+)
+
+var errVerify = errors.New("verification failed")
+
+// record is the exported form of a backed up message
+type record struct {
+	Name    string    `json:"name"`
+	UUID    string    `json:"uuid"`
+	Seq     int64     `json:"seq"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	File    string    `json:"file"`
+}
+
+// writer writes records in the selected format
+type writer interface {
+	Write(record) error
+	Flush() error
+}
+
+type (
+	jsonlWriter struct {
+		enc *json.Encoder
+	}
+
+	csvWriter struct {
+		w      *csv.Writer
+		header bool
+	}
+)
+
+func newWriter(out io.Writer, format string) (writer, error) {
+	switch format {
+	case formatJSONL:
+		return &jsonlWriter{json.NewEncoder(out)}, nil
+	case formatCSV:
+		return &csvWriter{w: csv.NewWriter(out)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+func (w *jsonlWriter) Write(r record) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonlWriter) Flush() error {
+	return nil
+}
+
+func (w *csvWriter) Write(r record) error {
+	if !w.header {
+		w.header = true
+
+		err := w.w.Write(
+			[]string{"name", "uuid", "seq", "time", "message", "file"})
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.w.Write([]string{
+		r.Name,
+		r.UUID,
+		strconv.FormatInt(r.Seq, 10),
+		r.Time.Format(time.RFC3339),
+		r.Message,
+		r.File,
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// actorFlags registers flags select actor instances
+func actorFlags(fs *flag.FlagSet) (name, uuid *string) {
+	name = fs.String("name", "", "actor name, empty matches all actors")
+	uuid = fs.String("uuid", "", "actor uuid, empty matches all instances")
+
+	return
+}
+
+// keysFlag registers flag loads backup decryption keys
+func keysFlag(fs *flag.FlagSet) *string {
+	return fs.String(
+		"keys",
+		"",
+		`JSON file of backup keys, {"Keys": {"<key id>": "<base64 key>"}}`,
+	)
+}
+
+// loadKeys returns KeyProvider decrypts encrypted messages, nil if file is
+// empty
+func loadKeys(file string) (actor.KeyProvider, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys actor.StaticKeys
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+
+	return keys, nil
+}
+
+func parseTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+func list(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	name, uuid := actorFlags(fs)
+	fs.Parse(args)
+
+	infos, err := idb.ListActors(ctx, *name, *uuid)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tUUID\tSTART\tEND\tROTATED")
+
+	for _, info := range infos {
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%s\t%d\n",
+			info.Name,
+			info.UUID,
+			formatTime(info.StartTime),
+			formatTime(info.EndTime),
+			len(info.Rotated),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func dump(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	name, uuid := actorFlags(fs)
+	format := fs.String("format", formatJSONL, "output format: jsonl, csv")
+	from := fs.String("from", "", "RFC3339 time, dump messages since")
+	to := fs.String("to", "", "RFC3339 time, dump messages until")
+	fromSeq := fs.Int64("from-seq", 0, "dump messages from sequence")
+	toSeq := fs.Int64("to-seq", 0, "dump messages to sequence")
+	keyFile := keysFlag(fs)
+	fs.Parse(args)
+
+	filter := idb.Filter{FromSeq: *fromSeq, ToSeq: *toSeq}
+
+	keys, err := loadKeys(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	if filter.From, err = parseTime(*from); err != nil {
+		return err
+	}
+
+	if filter.To, err = parseTime(*to); err != nil {
+		return err
+	}
+
+	w, err := newWriter(os.Stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	// each db file is read once, instances ordered by start time
+	err = idb.ReadBackup(
+		ctx,
+		*name,
+		*uuid,
+		filter,
+		func(r idb.Record) error {
+			rec, err := newRecord(r, keys)
+			if err != nil {
+				return err
+			}
+
+			return w.Write(rec)
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// newRecord returns exported record, decodes encoded message with keys
+func newRecord(r idb.Record, keys actor.KeyProvider) (record, error) {
+	msg, err := actor.DecodeBackupMessage(r.Message, keys)
+	if err != nil {
+		return record{}, fmt.Errorf("%s seq %d: %v", r.File, r.Seq, err)
+	}
+
+	return record{
+		Name:    r.Name,
+		UUID:    r.UUID,
+		Seq:     r.Seq,
+		Time:    r.Time,
+		Message: msg,
+		File:    r.File,
+	}, nil
+}
+
+func tail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	name, uuid := actorFlags(fs)
+	format := fs.String("format", formatJSONL, "output format: jsonl, csv")
+	lines := fs.Int("n", 10, "number of existing messages printed per actor")
+	interval := fs.Duration("interval", time.Second, "polling interval")
+	keyFile := keysFlag(fs)
+	fs.Parse(args)
+
+	keys, err := loadKeys(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	w, err := newWriter(os.Stdout, *format)
+	if err != nil {
+		return err
+	}
+
+	// follows messages across rotation
+	cur := idb.NewCursor()
+
+	poll := func(initial bool) error {
+		var uuids []string
+		records := make(map[string][]record)
+
+		err := idb.Follow(ctx, *name, *uuid, cur, func(r idb.Record) error {
+			rec, err := newRecord(r, keys)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := records[r.UUID]; !ok {
+				uuids = append(uuids, r.UUID)
+			}
+
+			records[r.UUID] = append(records[r.UUID], rec)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range uuids {
+			recs := records[id]
+			if initial && len(recs) > *lines {
+				recs = recs[len(recs)-*lines:]
+			}
+
+			for _, r := range recs {
+				if err := w.Write(r); err != nil {
+					return err
+				}
+			}
+		}
+
+		return w.Flush()
+	}
+
+	if err := poll(true); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := poll(false); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func verify(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	name, uuid := actorFlags(fs)
+	fs.Parse(args)
+
+	infos, err := idb.ListActors(ctx, *name, *uuid)
+	if err != nil {
+		return err
+	}
+
+	failed := false
+
+	for _, info := range infos {
+		files := info.Rotated
+		if info.File != "" {
+			files = append(files, info.File)
+		}
+
+		for _, file := range files {
+			if err := idb.VerifyFile(ctx, file); err != nil {
+				failed = true
+				fmt.Printf("FAIL %s: %v\n", file, err)
+				continue
+			}
+
+			fmt.Printf("ok   %s\n", file)
+		}
+	}
+
+	if failed {
+		return errVerify
+	}
+
+	return nil
+}
+
+func compact(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ExitOnError)
+	name, uuid := actorFlags(fs)
+	fs.Parse(args)
+
+	infos, err := idb.ListActors(ctx, *name, *uuid)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		for _, file := range info.Rotated {
+			before := fileSize(file)
+
+			if err := idb.CompactFile(ctx, file); err != nil {
+				return fmt.Errorf("%s: %v", file, err)
+			}
+
+			fmt.Printf("%s: %d -> %d bytes\n", file, before, fileSize(file))
+		}
+	}
+
+	return nil
+}
+
+func fileSize(file string) int64 {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return 0
+	}
+
+	return fi.Size()
+}
+
+func clean(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("clean", flag.ExitOnError)
+	maxAge := fs.Duration(
+		"max-age", 0, "remove rotated databases older than, 0: unlimited")
+	removeEnded := fs.Bool(
+		"remove-ended", false, "remove databases of actors ended or crashed longer than max-age, including snapshots and dead letters")
+	maxBytes := fs.Int64(
+		"max-bytes", 0, "remove oldest rotated databases while total size exceeds, 0: unlimited")
+	maxRotated := fs.Int(
+		"max-rotated", 0, "rotated databases preserved per actor, 0: unlimited")
+	fs.Parse(args)
+
+	removed, err := idb.Clean(ctx, idb.Retention{
+		MaxAge:        *maxAge,
+		MaxTotalBytes: *maxBytes,
+		MaxRotated:    *maxRotated,
+		RemoveEnded:   *removeEnded,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, file := range removed {
+		fmt.Printf("removed %s\n", file)
+	}
+
+	return nil
+}
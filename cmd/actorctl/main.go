@@ -0,0 +1,82 @@
+// actorctl inspects backup databases written by actor's sqlite backup
+//
+// Usage:
+//
+//	actorctl [-C dir] <command> [flags]
+//
+// Commands:
+//
+//	list     list actors with start/end times
+//	tail     print backed up messages as they arrive
+//	dump     dump backed up messages as JSON Lines or CSV
+//	verify   run integrity check on backup databases
+//	compact  reclaim unused space in rotated backup databases
+//	clean    remove backup databases selected by retention policy
+//
+// actorctl requires sqlite, build with tag 'database'.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	idb "github.com/vsdmars/actor/internal/db"
+)
+
+var commands = map[string]command{
+	"list":    {"list actors with start/end times", list},
+	"tail":    {"print backed up messages as they arrive", tail},
+	"dump":    {"dump backed up messages as JSON Lines or CSV", dump},
+	"verify":  {"run integrity check on backup databases", verify},
+	"compact": {"reclaim unused space in rotated backup databases", compact},
+	"clean":   {"remove backup databases selected by retention policy", clean},
+}
+
+var commandOrder = []string{"list", "tail", "dump", "verify", "compact", "clean"}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: actorctl [-C dir] <command> [flags]\n\n")
+	fmt.Fprintf(os.Stderr, "flags:\n")
+	flag.PrintDefaults()
+	fmt.Fprintf(os.Stderr, "\ncommands:\n")
+
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	dir := flag.String(
+		"C", "", "directory contains sqlitedb and sqlitedb_rotate, default: working directory")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "actorctl: unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	idb.SetRoot(*dir)
+
+	// create root context, cancelled on signal
+	ctx, cancel := signal.NotifyContext(
+		context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd.run(ctx, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "actorctl %s: %v\n", flag.Arg(0), err)
+		cancel()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import "context"
+
+type (
+	command struct {
+		usage string
+		run   func(ctx context.Context, args []string) error
+	}
+)
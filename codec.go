@@ -0,0 +1,61 @@
+package actor
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vsdmars/actor/decoder"
+)
+
+type (
+	// Codec serializes actor state and messages into bytes
+	Codec interface {
+		// Name identifies the codec, stored along with the serialized data
+		Name() string
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	// JSONCodec serializes with encoding/json
+	JSONCodec struct{}
+
+	// GobCodec serializes with encoding/gob
+	GobCodec struct{}
+)
+
+// Name returns "json"
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+// Marshal returns the json encoding of v
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes json data into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return decoder.JSONDecoder(data, v)
+}
+
+// Name returns "gob"
+func (GobCodec) Name() string {
+	return "gob"
+}
+
+// Marshal returns the gob encoding of v
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes gob data into v
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
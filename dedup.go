@@ -0,0 +1,193 @@
+package actor
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// default period message id is remembered
+	defaultDedupWindow = time.Minute
+	// default number of message ids remembered
+	defaultDedupSize = 10000
+)
+
+type (
+	// DedupConfig configures message deduplication
+	//
+	// A message id is remembered for Window, or until Size newer message
+	// ids are remembered, whichever comes first.
+	DedupConfig struct {
+		// Window is the period message id is remembered, <= 0: 1 minute
+		Window time.Duration
+		// Size is the number of message ids remembered, <= 0: 10000
+		Size int
+		// Persist stores message ids through actor's BackupStore, thus
+		// deduplication survives restarts. BackupStore must implement
+		// DedupStore.
+		Persist bool
+	}
+
+	// DedupStore is implemented by BackupStore supports persisted
+	// deduplication
+	DedupStore interface {
+		// MarkSeen records message id
+		MarkSeen(id string, t time.Time) error
+		// Seen returns message ids recorded since, by actor instances with
+		// the same name
+		Seen(since time.Time) (map[string]time.Time, error)
+	}
+
+	// dedup is a bounded window of seen message ids
+	dedup struct {
+		lock     sync.Mutex
+		window   time.Duration
+		size     int
+		order    *list.List // *seenID of delivered message, oldest first
+		ids      map[string]*list.Element
+		inflight map[string]chan struct{} // closed once delivery settles
+		store    DedupStore               // nil: not persisted
+	}
+
+	seenID struct {
+		id   string
+		time time.Time
+	}
+)
+
+func newDedup(cfg DedupConfig, store DedupStore) *dedup {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultDedupWindow
+	}
+
+	if cfg.Size <= 0 {
+		cfg.Size = defaultDedupSize
+	}
+
+	return &dedup{
+		window: cfg.Window,
+		size:   cfg.Size,
+		order:    list.New(),
+		ids:      make(map[string]*list.Element),
+		inflight: make(map[string]chan struct{}),
+		store:    store,
+	}
+}
+
+// load restores persisted message ids within window
+func (d *dedup) load() error {
+	seen, err := d.store.Seen(time.Now().Add(-d.window))
+	if err != nil {
+		return err
+	}
+
+	ids := make([]seenID, 0, len(seen))
+	for id, t := range seen {
+		ids = append(ids, seenID{id, t})
+	}
+
+	// restore in time order, thus eviction order is preserved
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].time.Before(ids[j].time)
+	})
+
+	defer d.lock.Unlock()
+	d.lock.Lock()
+
+	for _, s := range ids {
+		d.add(s)
+	}
+
+	return nil
+}
+
+// claim claims delivery of message id
+//
+// returns true if id is neither delivered within window nor in flight,
+// claimed id is settled by commit once message is delivered, or by forget if
+// delivery fails, thus the retried message is not dropped.
+//
+// returns the channel closed once in-flight delivery of id settles, nil if
+// id is delivered within window.
+func (d *dedup) claim(id string) (bool, <-chan struct{}) {
+	now := time.Now()
+
+	defer d.lock.Unlock()
+	d.lock.Lock()
+
+	d.expire(now)
+
+	if _, ok := d.ids[id]; ok {
+		return false, nil
+	}
+
+	if settled, ok := d.inflight[id]; ok {
+		return false, settled
+	}
+
+	d.inflight[id] = make(chan struct{})
+
+	return true, nil
+}
+
+// commit records and persists id claimed by claim
+func (d *dedup) commit(id string) error {
+	t := time.Now()
+
+	d.lock.Lock()
+	d.add(seenID{id, t})
+	d.settle(id)
+	d.lock.Unlock()
+
+	if d.store == nil {
+		return nil
+	}
+
+	return d.store.MarkSeen(id, t)
+}
+
+// forget releases id claimed by claim
+func (d *dedup) forget(id string) {
+	defer d.lock.Unlock()
+	d.lock.Lock()
+
+	d.settle(id)
+}
+
+// settle wakes up deliveries of id waiting for in-flight delivery
+func (d *dedup) settle(id string) {
+	if settled, ok := d.inflight[id]; ok {
+		close(settled)
+		delete(d.inflight, id)
+	}
+}
+
+func (d *dedup) add(s seenID) {
+	if _, ok := d.ids[s.id]; ok {
+		return
+	}
+
+	d.ids[s.id] = d.order.PushBack(&s)
+
+	for d.order.Len() > d.size {
+		d.remove(d.order.Front())
+	}
+}
+
+// expire removes ids older than window
+func (d *dedup) expire(now time.Time) {
+	for e := d.order.Front(); e != nil; e = d.order.Front() {
+		if now.Sub(e.Value.(*seenID).time) <= d.window {
+			return
+		}
+
+		d.remove(e)
+	}
+}
+
+func (d *dedup) remove(e *list.Element) {
+	delete(d.ids, e.Value.(*seenID).id)
+	d.order.Remove(e)
+}
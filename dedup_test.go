@@ -0,0 +1,243 @@
+package actor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// receiveCount returns number of messages received within timeout
+func receiveCount(act actor.Actor, timeout time.Duration) int {
+	cnt := 0
+
+	for {
+		select {
+		case <-act.Receive():
+			cnt++
+		case <-time.After(timeout):
+			return cnt
+		}
+	}
+}
+
+func TestDedup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 10, -1) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDedup(actor.DedupConfig{Window: 100 * time.Millisecond, Size: 2}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		env := actor.NewEnvelope("retried")
+
+		// retried sends are dropped
+		for idx := 0; idx < 3; idx++ {
+			if err := act.Send(env); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// messages without envelope are never deduplicated
+		act.Send("plain")
+		act.Send("plain")
+
+		if cnt := receiveCount(act, 50*time.Millisecond); cnt != 3 {
+			t.Errorf("expecting: 3 messages, receiving: %d", cnt)
+		}
+
+		// id expires after window
+		time.Sleep(100 * time.Millisecond)
+		act.Send(env)
+
+		// id evicted by newer ids
+		act.Send(&actor.Envelope{ID: "a", Message: "a"})
+		act.Send(&actor.Envelope{ID: "b", Message: "b"})
+		act.Send(env)
+
+		if cnt := receiveCount(act, 50*time.Millisecond); cnt != 4 {
+			t.Errorf("expecting: 4 messages, receiving: %d", cnt)
+		}
+	}
+}
+
+func TestDedupRetryAfterTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 1, -1) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDedup(actor.DedupConfig{}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		// fills the mailbox
+		if err := act.Send("filler"); err != nil {
+			t.Fatal(err)
+		}
+
+		env := actor.NewEnvelope("retried")
+
+		sendCtx, sendCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		err = act.SendContext(sendCtx, env)
+		sendCancel()
+
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+		}
+
+		<-act.Receive()
+
+		// retry of the undelivered message is not a duplicate
+		if err := act.SendContext(ctx, env); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case msg := <-act.Receive():
+			if msg.(*actor.Envelope).ID != env.ID {
+				t.Fatalf("expecting: message %s, receiving: %v", env.ID, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expecting: retried message delivered")
+		}
+	}
+}
+
+func TestDedupInFlight(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 1, -1) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDedup(actor.DedupConfig{}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		// fills the mailbox
+		if err := act.Send("filler"); err != nil {
+			t.Fatal(err)
+		}
+
+		env := actor.NewEnvelope("in flight")
+
+		first := make(chan error, 1)
+		go func() {
+			sendCtx, sendCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+			defer sendCancel()
+
+			first <- act.SendContext(sendCtx, env)
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+
+		// duplicate waits for the in-flight send, delivers once it fails
+		second := make(chan error, 1)
+		go func() { second <- act.Send(env) }()
+
+		if err := <-first; err != context.DeadlineExceeded {
+			t.Fatalf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+		}
+
+		<-act.Receive()
+
+		select {
+		case msg := <-act.Receive():
+			if msg.(*actor.Envelope).ID != env.ID {
+				t.Fatalf("expecting: message %s, receiving: %v", env.ID, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expecting: duplicate of failed message delivered")
+		}
+
+		if err := <-second; err != nil {
+			t.Fatal(err)
+		}
+
+		// delivered message is a duplicate
+		if err := act.Send(env); err != nil {
+			t.Fatal(err)
+		}
+
+		if cnt := receiveCount(act, 50*time.Millisecond); cnt != 0 {
+			t.Fatalf("expecting: 0 message, receiving: %d", cnt)
+		}
+	}
+}
+
+func TestPersistedDedup(t *testing.T) {
+	mem := actor.NewMemoryBackup()
+	env := &actor.Envelope{ID: "user supplied id", Message: "once"}
+
+	for _, tc := range createTestCase(1, 10, 0) {
+		for run := 0; run < 2; run++ {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			act, err := actor.NewActor(
+				ctx,
+				tc.name,
+				tc.buffer,
+				func(act actor.Actor) { <-act.Done() },
+				tc.backup,
+				actor.WithBackup(mem.Store),
+				actor.WithDedup(actor.DedupConfig{Persist: true}),
+			)
+			if err != nil {
+				t.Fatal(createActorErr)
+			}
+
+			act.Send(env)
+
+			expect := 1 - run // dropped after restart
+			if cnt := receiveCount(act, 50*time.Millisecond); cnt != expect {
+				t.Errorf("run %d expecting: %d message, receiving: %d", run, expect, cnt)
+			}
+
+			cancel()
+			waitDeregister(t, tc.name)
+		}
+	}
+}
+
+func TestPersistedDedupUnsupported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, -1) {
+		_, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDedup(actor.DedupConfig{Persist: true}),
+		)
+		if err != actor.ErrDedupUnsupported {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrDedupUnsupported, err)
+		}
+	}
+}
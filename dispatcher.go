@@ -0,0 +1,290 @@
+package actor
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// default messages processed per actor per scheduling turn
+const defaultThroughput = 5
+
+type (
+	// ReceiveFunc is the message-driven actor behavior
+	//
+	// ReceiveFunc is called with actor's context for each message, by a
+	// single dispatcher worker at a time, it must not block unless actor is
+	// scheduled on a pinned dispatcher.
+	ReceiveFunc func(ctx context.Context, msg interface{})
+
+	// DispatcherConfig configures Dispatcher
+	DispatcherConfig struct {
+		// Workers is the number of worker goroutines shared by actors,
+		// <= 0: GOMAXPROCS
+		Workers int
+		// Throughput is the number of messages processed per actor per
+		// scheduling turn before the worker moves on to the next actor,
+		// <= 0: 5
+		Throughput int
+		// Pinned dedicates a goroutine per actor, for actors blocking in
+		// ReceiveFunc, Workers is ignored
+		Pinned bool
+	}
+
+	// Dispatcher schedules message-driven actors created by Spawn
+	//
+	// Actors with pending messages are queued in FIFO order and processed
+	// by a bounded pool of workers, thus idle actors hold no goroutine.
+	Dispatcher struct {
+		cfg     DispatcherConfig
+		lock    sync.Mutex
+		cond    *sync.Cond
+		queue   []*localActor // actors with pending messages
+		stopped bool
+		wg      sync.WaitGroup
+	}
+
+	// dispatch is the state of actor scheduled by Dispatcher
+	dispatch struct {
+		scheduled  int32      // atomic, 1: queued or running on dispatcher
+		turn       sync.Mutex // held while processing messages
+		lastActive int64      // atomic, unix nano of last processing turn
+	}
+)
+
+var (
+	defaultDispatcherOnce sync.Once
+	defaultDispatcher     *Dispatcher
+)
+
+// DefaultDispatcher returns the Dispatcher used by Spawn without
+// WithDispatcher option
+func DefaultDispatcher() *Dispatcher {
+	defaultDispatcherOnce.Do(func() {
+		defaultDispatcher = NewDispatcher(DispatcherConfig{})
+	})
+
+	return defaultDispatcher
+}
+
+// NewDispatcher creates Dispatcher and starts its workers
+func NewDispatcher(cfg DispatcherConfig) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.GOMAXPROCS(0)
+	}
+
+	if cfg.Throughput <= 0 {
+		cfg.Throughput = defaultThroughput
+	}
+
+	d := &Dispatcher{cfg: cfg}
+	d.cond = sync.NewCond(&d.lock)
+
+	if !cfg.Pinned {
+		for idx := 0; idx < cfg.Workers; idx++ {
+			d.wg.Add(1)
+			go d.work()
+		}
+	}
+
+	return d
+}
+
+// Stop stops workers once their current turn completes
+//
+// messages of actors on a stopped dispatcher are no longer processed,
+// cancel the actors before stopping their dispatcher.
+func (d *Dispatcher) Stop() {
+	d.lock.Lock()
+	d.stopped = true
+	d.queue = nil
+	d.cond.Broadcast()
+	d.lock.Unlock()
+
+	d.wg.Wait()
+}
+
+// Spawn creates a message-driven actor scheduled on a Dispatcher
+//
+// Unlike NewActor, the actor holds no goroutine while idle, receive is
+// called for each message by the dispatcher set by WithDispatcher, or
+// DefaultDispatcher. Actor's mailbox is a RingMailbox holds buffer
+// messages, rounded up to power of two. Panic in receive stops the actor.
+//
+// ctx: caller's context, able to cancel created actor
+//
+// b: < 0: disable backup, == 0: backup without rotation, > 0: backup with rotation rows
+func Spawn(
+	ctx context.Context,
+	name string,
+	buffer int,
+	receive ReceiveFunc,
+	b int,
+	opts ...Option,
+) (Actor, error) {
+	o := newOptions(opts)
+	o.ring = true
+	o.receiveFn = receive
+	o.measured = true
+
+	if o.dispatcher == nil {
+		o.dispatcher = DefaultDispatcher()
+	}
+
+	la, recovered, err := newActor(ctx, name, buffer, b, o)
+	if err != nil {
+		return nil, err
+	}
+
+	d := la.options.dispatcher
+
+	atomic.StoreInt64(&la.lastActive, time.Now().UnixNano())
+	la.startStamp()
+
+	if la.relay != nil {
+		go la.relay.run()
+	}
+
+	if len(recovered) > 0 {
+		go la.redeliver(recovered)
+	}
+
+	context.AfterFunc(la.ctx, la.stop)
+
+	if d.cfg.Pinned {
+		go d.pin(la)
+	} else if la.ring.Len() > 0 {
+		d.schedule(la)
+	}
+
+	return la, nil
+}
+
+// dispatched reports whether actor is created by Spawn
+func (actor *localActor) dispatched() bool {
+	return actor.receiveFn != nil
+}
+
+// stop releases dispatched actor once its current turn completes
+func (actor *localActor) stop() {
+	defer actor.turn.Unlock()
+	actor.turn.Lock()
+
+	regActor.deregister(actor)
+	actor.endStamp()
+	actor.close()
+}
+
+// schedule queues actor for a turn unless it's queued or running
+func (d *Dispatcher) schedule(actor *localActor) {
+	if d.cfg.Pinned || !atomic.CompareAndSwapInt32(&actor.scheduled, 0, 1) {
+		return
+	}
+
+	d.lock.Lock()
+	if !d.stopped {
+		d.queue = append(d.queue, actor)
+		d.cond.Signal()
+	}
+	d.lock.Unlock()
+}
+
+// work runs turns of queued actors until dispatcher is stopped
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	// sender of messages sent by receive
+	slot := trackHandler()
+	defer slot.release()
+
+	buf := make([]interface{}, d.cfg.Throughput)
+
+	for {
+		d.lock.Lock()
+		for len(d.queue) == 0 && !d.stopped {
+			d.cond.Wait()
+		}
+
+		if d.stopped {
+			d.lock.Unlock()
+			return
+		}
+
+		actor := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.lock.Unlock()
+
+		actor.turn.Lock()
+		if actor.ctx.Err() == nil {
+			slot.set(actor.name)
+			actor.process(buf[:actor.ring.TryReceive(buf)])
+			slot.set("")
+		}
+		actor.turn.Unlock()
+
+		atomic.StoreInt32(&actor.scheduled, 0)
+
+		// remaining messages are processed after other queued actors
+		if actor.ring.Len() > 0 && actor.ctx.Err() == nil {
+			d.schedule(actor)
+		}
+	}
+}
+
+// pin processes messages of actor on a dedicated goroutine until actor is
+// cancelled
+func (d *Dispatcher) pin(actor *localActor) {
+	// sender of messages sent by receive
+	slot := trackHandler()
+	slot.set(actor.name)
+	defer slot.release()
+
+	buf := make([]interface{}, d.cfg.Throughput)
+
+	for {
+		n, err := actor.ring.Receive(actor.ctx, buf)
+		if err != nil {
+			return
+		}
+
+		actor.turn.Lock()
+		if actor.ctx.Err() == nil {
+			actor.process(buf[:n])
+		}
+		actor.turn.Unlock()
+	}
+}
+
+// process calls actor's ReceiveFunc for messages, releases references to
+// processed messages
+func (actor *localActor) process(msgs []interface{}) {
+	defer func() {
+		for idx := range msgs {
+			msgs[idx] = nil
+		}
+
+		if r := recover(); r != nil {
+			actor.reportPanic(r)
+			actor.close()
+		}
+
+		actor.handling.Store((*Envelope)(nil))
+	}()
+
+	atomic.StoreInt64(&actor.lastActive, time.Now().UnixNano())
+
+	m := getMetrics()
+
+	for _, msg := range msgs {
+		// reported if receive panics, nil for plain message
+		env, _ := msg.(*Envelope)
+		actor.handling.Store(env)
+
+		start := actor.recordReceive(m)
+		actor.receiveFn(actor.ctx, msg)
+		actor.recordHandled(m, start)
+	}
+}
@@ -0,0 +1,294 @@
+package actor_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestDispatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const actors, messages = 100, 100
+
+	d := actor.NewDispatcher(actor.DispatcherConfig{Workers: 2})
+	defer d.Stop()
+
+	var sum int64
+	var wg sync.WaitGroup
+	wg.Add(actors * messages)
+
+	cases := createTestCase(actors, 16, -1)
+	acts := make([]actor.Actor, actors)
+
+	for idx, tc := range cases {
+		act, err := actor.Spawn(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(ctx context.Context, msg interface{}) {
+				atomic.AddInt64(&sum, int64(msg.(int)))
+				wg.Done()
+			},
+			tc.backup,
+			actor.WithDispatcher(d),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		acts[idx] = act
+	}
+
+	for _, act := range acts {
+		go func(act actor.Actor) {
+			for idx := 0; idx < messages; idx++ {
+				if err := act.Send(idx); err != nil {
+					t.Error(err)
+				}
+			}
+		}(act)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	if expect := int64(actors * messages * (messages - 1) / 2); sum != expect {
+		t.Fatalf("expecting: sum %d, receiving: %d", expect, sum)
+	}
+
+	cancel()
+
+	for _, tc := range cases {
+		waitDeregister(t, tc.name)
+	}
+
+	if err := acts[0].Send(0); err != actor.ErrChannelClosed {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrChannelClosed, err)
+	}
+}
+
+func TestDispatcherThroughput(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := actor.NewDispatcher(actor.DispatcherConfig{Workers: 1, Throughput: 2})
+	defer d.Stop()
+
+	var lock sync.Mutex
+	var order []string
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	cases := createTestCase(3, 8, -1)
+
+	// occupies the single worker until mailboxes of others are filled
+	blocker, err := actor.Spawn(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(ctx context.Context, msg interface{}) { <-release },
+		cases[0].backup,
+		actor.WithDispatcher(d),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	acts := make([]actor.Actor, 2)
+
+	for idx, tc := range cases[1:] {
+		label := string(rune('a' + idx))
+
+		acts[idx], err = actor.Spawn(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(ctx context.Context, msg interface{}) {
+				lock.Lock()
+				order = append(order, fmt.Sprintf("%s%d", label, msg))
+				if len(order) == 8 {
+					close(done)
+				}
+				lock.Unlock()
+			},
+			tc.backup,
+			actor.WithDispatcher(d),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+	}
+
+	blocker.Send(struct{}{})
+
+	for idx := 0; idx < 4; idx++ {
+		acts[0].Send(idx)
+	}
+
+	for idx := 0; idx < 4; idx++ {
+		acts[1].Send(idx)
+	}
+
+	close(release)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	// actors take turns of Throughput messages
+	expect := "a0 a1 b0 b1 a2 a3 b2 b3"
+	if got := strings.Join(order, " "); got != expect {
+		t.Fatalf("expecting: %s, receiving: %s", expect, got)
+	}
+}
+
+func TestDispatcherPinned(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := actor.NewDispatcher(actor.DispatcherConfig{Pinned: true})
+	defer d.Stop()
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	cases := createTestCase(2, 4, -1)
+
+	for _, tc := range cases {
+		act, err := actor.Spawn(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(ctx context.Context, msg interface{}) {
+				started <- struct{}{}
+
+				// blocking work
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			},
+			tc.backup,
+			actor.WithDispatcher(d),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		act.Send(struct{}{})
+	}
+
+	// both actors block at the same time on their own goroutine
+	for idx := 0; idx < 2; idx++ {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+
+	close(release)
+	cancel()
+
+	for _, tc := range cases {
+		waitDeregister(t, tc.name)
+	}
+}
+
+func TestDispatcherPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc := createTestCase(1, 4, -1)[0]
+	act, err := actor.Spawn(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(ctx context.Context, msg interface{}) {
+			panic(msg)
+		},
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if s, _ := actor.Stats(tc.name); s.Idle > time.Second {
+		t.Fatalf("expecting: idle since spawn, receiving: %v", s.Idle)
+	}
+
+	act.Send("boom")
+
+	// panic stops the actor only
+	waitDeregister(t, tc.name)
+
+	if err := act.Send(0); err != actor.ErrChannelClosed {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrChannelClosed, err)
+	}
+}
+
+func TestDispatcherPanicMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	tc := createTestCase(1, 4, -1)[0]
+	act, err := actor.Spawn(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(ctx context.Context, msg interface{}) {
+			if _, ok := msg.(*actor.Envelope); !ok {
+				panic(msg)
+			}
+		},
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	act.Send(actor.NewEnvelope("hello"))
+	act.Send("boom")
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case ev := <-sub.C:
+			p, ok := ev.(actor.Panic)
+			if !ok || p.Actor != act.Name() {
+				continue
+			}
+
+			// envelope processed before is not reported
+			if p.Envelope != nil {
+				t.Fatalf("expecting: no envelope, receiving: %v", p.Envelope)
+			}
+
+			return
+		case <-timeout:
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package actor
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Envelope wraps message with its metadata
+//
+// Handler of actor created with WithDurableMailbox receives *Envelope from
+// Receive, and calls Ack once the message is processed. Unacknowledged
+// messages are redelivered to the next actor instance with the same name.
+//
+// Sending *Envelope delivers a copy of it, with the message id preserved,
+// thus retried sends of the same envelope are deduplicated by actor created
+// with WithDedup.
+//
+// Envelope sent by SendContext carries the sender's context, and its Header
+// carries the context's deadline and propagated values for remote
+// transports.
+type Envelope struct {
+	ID      string          // message id
+	Message interface{}     // sent message
+	Attempt int             // delivery attempt, starts from 1
+	Header  Header          // request-scoped values for remote transports
+	Path    []string        // actors forwarded the message, oldest first
+	ctx     context.Context // sender's context, nil: background
+	span    SpanContext     // send span, invalid: not traced
+	sent    time.Time       // time delivered into mailbox
+	codec   string          // name of the codec serialized payload
+	payload []byte          // serialized message
+	actor   *localActor     // receiving actor
+}
+
+// NewEnvelope returns envelope of message with a generated message id
+func NewEnvelope(message interface{}) *Envelope {
+	return &Envelope{
+		ID:      uuid.New().String(),
+		Message: message,
+	}
+}
+
+// Context returns the context message is sent with
+//
+// returns context.Background() if message is not sent by SendContext,
+// context does not survive redelivery by durable mailbox. Messages sent with
+// the context by SendContext are recorded by Topology as sent by receiving
+// actor of the envelope.
+func (e *Envelope) Context() context.Context {
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return e.withSender(e.withPath(ctx))
+}
+
+// Decode deserializes message into v with receiving actor's codec
+//
+// Message of a redelivered envelope is decoded into interface{}, which
+// loses its concrete type, use Decode to restore the typed message.
+//
+// only envelopes delivered by durable mailbox or outbox relay are
+// serialized, returns ErrMailboxDisabled otherwise
+func (e *Envelope) Decode(v interface{}) error {
+	if e.payload == nil {
+		return ErrMailboxDisabled
+	}
+
+	if e.codec != e.actor.codec.Name() {
+		return ErrMessageCodec
+	}
+
+	return e.actor.codec.Unmarshal(e.payload, v)
+}
+
+// Ack acknowledges message is processed, removes it from durable mailbox
+//
+// noop if receiving actor's mailbox is not durable
+func (e *Envelope) Ack() error {
+	if e.actor == nil || e.actor.mailbox == nil {
+		return nil
+	}
+
+	return e.actor.mailbox.Ack(e.ID)
+}
+
+// Nack reports message processing failure, message is redelivered
+//
+// message is moved into dead letter queue once its attempts reach the
+// limit set by WithDurableMailbox
+func (e *Envelope) Nack(reason string) error {
+	if e.actor == nil || e.actor.mailbox == nil {
+		return ErrMailboxDisabled
+	}
+
+	return e.actor.retry(e, reason)
+}
@@ -1,16 +1,67 @@
 package actor
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/eapache/go-resiliency/semaphore"
+	idb "github.com/vsdmars/actor/internal/db"
+	"github.com/vsdmars/actor/internal/filelog"
+)
 
 var (
+	// ErrBackupClosed backup store is closed
+	ErrBackupClosed = errors.New("backup closed error")
+	// ErrBackupCorrupt file backup record is corrupted
+	ErrBackupCorrupt = filelog.ErrCorrupt
+	// ErrBackupDisabled actor created without backup
+	ErrBackupDisabled = errors.New("backup disabled error")
+	// ErrBackupEncoding backup message encoding is malformed
+	ErrBackupEncoding = errors.New("backup encoding error")
+	// ErrBackupKey backup message key is missing or invalid
+	ErrBackupKey = errors.New("backup key error")
+	// ErrBulkheadFull in-flight asks to target actor reach the limit
+	ErrBulkheadFull = semaphore.ErrNoTickets
 	// ErrChannelBuffer channel buffer setting error
 	ErrChannelBuffer = errors.New("channel buffer error")
 	// ErrChannelClosed channel is in closed state
 	ErrChannelClosed = errors.New("channel in closed state error")
+	// ErrCircuitOpen circuit breaker of target actor is open
+	ErrCircuitOpen = breaker.ErrBreakerOpen
+	// ErrDedupUnsupported actor's BackupStore does not support persisted dedup
+	ErrDedupUnsupported = errors.New("dedup persistence unsupported error")
+	// ErrFSMState FSM state is not declared with handler
+	ErrFSMState = errors.New("fsm state undeclared error")
+	// ErrMailboxDisabled actor created without durable mailbox
+	ErrMailboxDisabled = errors.New("durable mailbox disabled error")
+	// ErrMailboxUnsupported actor's BackupStore does not support durable mailbox
+	ErrMailboxUnsupported = errors.New("durable mailbox unsupported error")
+	// ErrMessageCodec message serialized by a different codec
+	ErrMessageCodec = errors.New("message codec mismatch error")
+	// ErrNoSqlite sqlite backup is not compiled in, build with tag 'database'
+	ErrNoSqlite = idb.ErrNoSqlite
+	// ErrOutboxDisabled actor created without outbox
+	ErrOutboxDisabled = errors.New("outbox disabled error")
+	// ErrOutboxUnsupported actor's BackupStore does not support outbox
+	ErrOutboxUnsupported = errors.New("outbox unsupported error")
 	// ErrRegisterActor register actor error
 	ErrRegisterActor = errors.New("register actor error")
 	// ErrRetrieveActor retrieve actor error
 	ErrRetrieveActor = errors.New("retrieve actor error")
+	// ErrRetrieveMessage message is not found in durable mailbox
+	ErrRetrieveMessage = errors.New("retrieve message error")
+	// ErrRingReceive Receive called on actor created with ring mailbox
+	ErrRingReceive = errors.New("receive on ring mailbox error, use ReceiveBatch")
 	// ErrSend actor send message error
 	ErrSend = errors.New("send message error")
+	// ErrSnapshotChecksum stored snapshots fail checksum verification
+	ErrSnapshotChecksum = idb.ErrSnapshotChecksum
+	// ErrSnapshotCodec snapshot serialized by a different codec
+	ErrSnapshotCodec = errors.New("snapshot codec mismatch error")
+	// ErrSnapshotNotFound actor has no snapshot stored
+	ErrSnapshotNotFound = idb.ErrSnapshotNotFound
+	// ErrSnapshotUnsupported actor's BackupStore does not support snapshot
+	ErrSnapshotUnsupported = errors.New("snapshot unsupported error")
+	// ErrStashFull actor's stash reaches its capacity
+	ErrStashFull = errors.New("stash full error")
 )
@@ -0,0 +1,111 @@
+package actor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Subscription receives events published by the actor runtime
+	//
+	// Events are delivered without blocking the publisher, events are
+	// dropped while subscription's buffer is full.
+	Subscription struct {
+		dropped uint64             // 64-bit aligned for atomic access
+		C       <-chan interface{} // published events
+		c       chan interface{}
+	}
+
+	eventStream struct {
+		rwLock sync.RWMutex
+		subs   map[*Subscription]struct{}
+	}
+
+	// Panic is published when actor's handler panics
+	Panic struct {
+		Actor    string      // actor name
+		UUID     string      // actor uuid
+		Reason   interface{} // value passed to panic
+		Envelope *Envelope   // message processed by handler, nil: unknown
+		Time     time.Time   // event time
+	}
+
+	// DeadLetter is published when a message is moved into dead letter queue
+	DeadLetter struct {
+		Actor    string    // actor name
+		UUID     string    // actor uuid
+		Envelope *Envelope // dead message
+		Reason   string    // reason of moving into dead letter queue
+		Time     time.Time // event time
+	}
+
+	// CircuitStateChange is published when breaker state of target actor
+	// of Resilient changes
+	CircuitStateChange struct {
+		Target string       // target actor name
+		From   CircuitState // previous state
+		To     CircuitState // current state
+		Time   time.Time    // event time
+	}
+
+	// Transition is published when FSM actor changes state
+	Transition struct {
+		Actor string    // actor name
+		UUID  string    // actor uuid
+		From  State     // previous state, "": actor starts
+		To    State     // current state
+		Time  time.Time // event time
+	}
+)
+
+var events = eventStream{subs: make(map[*Subscription]struct{})}
+
+// Subscribe subscribes events published by the actor runtime
+//
+// buffer: number of events buffered, <= 0: 64 events
+func Subscribe(buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = 64
+	}
+
+	c := make(chan interface{}, buffer)
+	s := &Subscription{C: c, c: c}
+
+	defer events.rwLock.Unlock()
+	events.rwLock.Lock()
+
+	events.subs[s] = struct{}{}
+
+	return s
+}
+
+// Unsubscribe stops receiving events and closes subscription's channel
+func (s *Subscription) Unsubscribe() {
+	defer events.rwLock.Unlock()
+	events.rwLock.Lock()
+
+	if _, ok := events.subs[s]; ok {
+		delete(events.subs, s)
+		close(s.c)
+	}
+}
+
+// Dropped returns number of events dropped due to full buffer
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// publish delivers event to subscribers without blocking
+func publish(event interface{}) {
+	defer events.rwLock.RUnlock()
+	events.rwLock.RLock()
+
+	for s := range events.subs {
+		select {
+		case s.c <- event:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
@@ -19,7 +19,7 @@ func logActor(act actor.Actor) {
 			return
 		case v := <-act.Receive():
 			fmt.Printf("LOG MESSAGE: %v\n", v)
-			go act.Backup(string(v.(string)))
+			act.Backup(string(v.(string)))
 		}
 	}
 }
@@ -92,7 +92,22 @@ func main() {
 	RegisterHandler(syscall.SIGINT, quitSig)
 
 	// create logging actor 'logger' and standby
-	actor.NewActor(ctx, "logger", 3, logActor, 3)
+	// backup messages are written in batch, flushed on actor stop
+	batch := actor.WithBatchBackup(0, 0)
+
+	// sqlite backup requires build tag 'database', fall back to file backup
+	_, err := actor.NewActor(ctx, "logger", 3, logActor, 3, batch)
+	if err == actor.ErrNoSqlite {
+		actor.NewActor(
+			ctx,
+			"logger",
+			3,
+			logActor,
+			3,
+			batch,
+			actor.WithBackup(actor.FileBackup("filelog", 0)),
+		)
+	}
 
 	// starts test
 	go test(ctx)
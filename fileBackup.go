@@ -0,0 +1,290 @@
+package actor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vsdmars/actor/internal/filelog"
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+const (
+	fileEntryStart   = "start"
+	fileEntryMessage = "message"
+	fileEntryStop    = "stop"
+)
+
+type (
+	// fileEntry is a record payload of the file log
+	fileEntry struct {
+		Type    string `json:"type"`
+		Seq     int64  `json:"seq,omitempty"`
+		Time    string `json:"time"`
+		Message string `json:"message,omitempty"`
+	}
+
+	// fileStore is the segmented file log BackupStore of an actor instance
+	fileStore struct {
+		lock sync.Mutex
+		log  *filelog.Log
+		seq  int64
+	}
+
+	// fileInstance is the file log of an actor instance
+	fileInstance struct {
+		uuid   string
+		prefix string
+		start  time.Time // time of first record, zero: log is empty
+	}
+)
+
+// FileBackup returns BackupFactory creates segmented file log BackupStore
+//
+// FileBackup is pure Go, it does not require cgo as sqlite backup does.
+//
+// Each actor instance appends length-prefixed, crc32c checked records into
+// segment files dir/<name>_<uuid>_<N>.seg. The active segment is rotated once
+// its size exceeds segmentBytes or, if actor's rotate > 0, its records exceed
+// rotate. Torn records left by a crash of previous instances with the same
+// name are truncated before the new instance's log is opened. Backed up
+// messages are read by BackupReader.WithFileBackup.
+//
+// segmentBytes: <= 0: default 64MiB, > 0: rotate segment once size exceeds
+func FileBackup(dir string, segmentBytes int64) BackupFactory {
+	return func(
+		ctx context.Context,
+		name, uuid string,
+		rotate int,
+	) (BackupStore, error) {
+		repairInstances(dir, name)
+
+		lg, err := filelog.Open(
+			dir,
+			fmt.Sprintf("%s_%s", name, uuid),
+			segmentBytes,
+			rotate,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return &fileStore{log: lg}, nil
+	}
+}
+
+func (s *fileStore) append(entries ...fileEntry) error {
+	defer s.lock.Unlock()
+	s.lock.Lock()
+
+	payloads := make([][]byte, 0, len(entries))
+	seq := s.seq
+
+	for _, e := range entries {
+		if e.Type == fileEntryMessage {
+			seq++
+			e.Seq = seq
+		}
+
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		payloads = append(payloads, b)
+	}
+
+	s.seq = seq
+
+	if err := s.log.Append(payloads...); err != nil {
+		if err == filelog.ErrClosed {
+			return ErrBackupClosed
+		}
+
+		return err
+	}
+
+	return s.log.Flush()
+}
+
+func (s *fileStore) Start(startTime time.Time) error {
+	return s.append(fileEntry{
+		Type: fileEntryStart,
+		Time: startTime.Format(time.RFC3339Nano),
+	})
+}
+
+func (s *fileStore) Insert(msg string) error {
+	return s.append(fileEntry{
+		Type:    fileEntryMessage,
+		Time:    time.Now().Format(time.RFC3339Nano),
+		Message: msg,
+	})
+}
+
+func (s *fileStore) InsertBatch(msgs []string) error {
+	now := time.Now().Format(time.RFC3339Nano)
+	entries := make([]fileEntry, 0, len(msgs))
+
+	for _, msg := range msgs {
+		entries = append(entries, fileEntry{
+			Type:    fileEntryMessage,
+			Time:    now,
+			Message: msg,
+		})
+	}
+
+	return s.append(entries...)
+}
+
+func (s *fileStore) Stop(endTime time.Time) error {
+	return s.append(fileEntry{
+		Type: fileEntryStop,
+		Time: endTime.Format(time.RFC3339Nano),
+	})
+}
+
+func (s *fileStore) Close() {
+	s.log.Close()
+}
+
+// repairInstances truncates torn tails of logs of actor instances with the
+// name which are not running, left by a crash
+func repairInstances(dir, name string) {
+	instances, err := fileInstances(dir, name, "")
+	if err != nil {
+		return
+	}
+
+	for _, inst := range instances {
+		regActor.rwLock.RLock()
+		_, running := regActor.uuidActor[inst.uuid]
+		regActor.rwLock.RUnlock()
+
+		if running {
+			continue
+		}
+
+		if err := filelog.Repair(dir, inst.prefix); err != nil {
+			l.GetLog().Error(
+				"file backup repair error",
+				zap.String("service", serviceName),
+				zap.String("actor", name),
+				zap.String("uuid", inst.uuid),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// fileInstances returns file logs of actor instances with the name ordered
+// by start time
+//
+// id: empty string matches all instances
+func fileInstances(dir, name, id string) ([]fileInstance, error) {
+	prefixes, err := filelog.Prefixes(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []fileInstance
+
+	for _, prefix := range prefixes {
+		// prefix is <name>_<uuid>, names may contain '_'
+		u := strings.TrimPrefix(prefix, name+"_")
+		if u == prefix || (id != "" && u != id) {
+			continue
+		}
+
+		if _, err := uuid.Parse(u); err != nil || len(u) != 36 {
+			continue
+		}
+
+		inst := fileInstance{uuid: u, prefix: prefix}
+
+		// first record is the start entry unless it's not written yet
+		errStop := fmt.Errorf("stop")
+		filelog.Read(dir, prefix, func(payload []byte) error {
+			var e fileEntry
+			if json.Unmarshal(payload, &e) == nil {
+				inst.start, _ = time.Parse(time.RFC3339Nano, e.Time)
+			}
+
+			return errStop
+		})
+
+		instances = append(instances, inst)
+	}
+
+	// empty logs belong to the latest instances
+	sort.SliceStable(instances, func(i, j int) bool {
+		si, sj := instances[i].start, instances[j].start
+		return !si.IsZero() && (sj.IsZero() || si.Before(sj))
+	})
+
+	return instances, nil
+}
+
+// readFileBackup iterates messages backed up by FileBackup under dir in
+// order
+func readFileBackup(
+	ctx context.Context,
+	dir, name, id string,
+	filter BackupFilter,
+	fn func(uuid string, seq int64, t time.Time, msg, file string) error,
+) error {
+	instances, err := fileInstances(dir, name, id)
+	if err != nil {
+		return err
+	}
+
+	for _, inst := range instances {
+		segs, err := filelog.Segments(dir, inst.prefix)
+		if err != nil {
+			return err
+		}
+
+		for _, seg := range segs {
+			err := filelog.ReadSegment(seg.File, func(payload []byte) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var e fileEntry
+				if err := json.Unmarshal(payload, &e); err != nil {
+					return err
+				}
+
+				if e.Type != fileEntryMessage ||
+					(filter.FromSeq > 0 && e.Seq < filter.FromSeq) ||
+					(filter.ToSeq > 0 && e.Seq > filter.ToSeq) {
+					return nil
+				}
+
+				t, err := time.Parse(time.RFC3339Nano, e.Time)
+				if err != nil {
+					return err
+				}
+
+				if (!filter.From.IsZero() && t.Before(filter.From)) ||
+					(!filter.To.IsZero() && t.After(filter.To)) {
+					return nil
+				}
+
+				return fn(inst.uuid, e.Seq, t, e.Message, seg.File)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
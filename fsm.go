@@ -0,0 +1,288 @@
+package actor
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type (
+	// State is a state of FSM
+	State string
+
+	// StateHandler processes message received in a state
+	//
+	// returns the next state, returns the current state or "" to stay
+	// without transition.
+	StateHandler func(ctx ActorContext, msg interface{}) State
+
+	// FSM declares states of finite state machine actor created by
+	// NewFSMActor
+	//
+	// FSM is built once and shared by actors, each actor keeps its own
+	// current state.
+	FSM struct {
+		initial State
+		states  map[State]*fsmState
+		persist bool
+	}
+
+	// StateTimeout is received by handler once state's timeout elapses,
+	// if the state is declared by Timeout with nil message
+	StateTimeout struct {
+		State State // state timed out
+	}
+
+	fsmState struct {
+		handler StateHandler
+		enter   func(ctx ActorContext, from State)
+		exit    func(ctx ActorContext, to State)
+		timeout time.Duration // 0: no timeout
+		msg     interface{}   // message fired by timeout
+	}
+
+	// fsmBehavior runs FSM for a single actor
+	fsmBehavior struct {
+		fsm   *FSM
+		state State
+		timer *time.Timer // timer of current state timeout
+		gen   uint64      // incremented per transition, stale timeouts dropped
+	}
+
+	// fsmTimeout is pushed into mailbox by state timer
+	fsmTimeout struct {
+		gen uint64
+		msg interface{}
+	}
+
+	// fsmSnapshot is the persisted state of FSM actor
+	fsmSnapshot struct {
+		State State `json:"state"`
+	}
+)
+
+// NewFSM creates FSM starts in initial state
+func NewFSM(initial State) *FSM {
+	return &FSM{
+		initial: initial,
+		states:  make(map[State]*fsmState),
+	}
+}
+
+// State declares state s with its message handler
+func (f *FSM) State(s State, h StateHandler) *FSM {
+	f.state(s).handler = h
+	return f
+}
+
+// OnEnter sets hook invoked once FSM enters state s
+func (f *FSM) OnEnter(s State, fn func(ctx ActorContext, from State)) *FSM {
+	f.state(s).enter = fn
+	return f
+}
+
+// OnExit sets hook invoked once FSM leaves state s
+func (f *FSM) OnExit(s State, fn func(ctx ActorContext, to State)) *FSM {
+	f.state(s).exit = fn
+	return f
+}
+
+// Timeout sends msg to the actor once it stays in state s for d
+//
+// timer starts once FSM enters s and is stopped once FSM leaves s.
+// msg: nil: StateTimeout{State: s}
+func (f *FSM) Timeout(s State, d time.Duration, msg interface{}) *FSM {
+	if msg == nil {
+		msg = StateTimeout{State: s}
+	}
+
+	st := f.state(s)
+	st.timeout, st.msg = d, msg
+
+	return f
+}
+
+// Persist saves current state as actor's snapshot on each transition, FSM
+// actor restarted with the same name resumes in the saved state
+//
+// actor's BackupStore must support snapshots, see SaveSnapshot.
+func (f *FSM) Persist() *FSM {
+	f.persist = true
+	return f
+}
+
+func (f *FSM) state(s State) *fsmState {
+	st, ok := f.states[s]
+	if !ok {
+		st = &fsmState{}
+		f.states[s] = st
+	}
+
+	return st
+}
+
+// validate checks initial state and every state is declared with handler
+func (f *FSM) validate() error {
+	if _, ok := f.states[f.initial]; !ok {
+		return ErrFSMState
+	}
+
+	for _, st := range f.states {
+		if st.handler == nil {
+			return ErrFSMState
+		}
+	}
+
+	return nil
+}
+
+// NewFSMActor creates actor runs fsm
+//
+// Actor enters fsm's initial state, or the persisted state if fsm is
+// created with Persist, before receiving the first message. Transition
+// events are published to subscribers of Subscribe. Parameters are the
+// same as NewBehaviorActor.
+func NewFSMActor(
+	ctx context.Context,
+	name string,
+	buffer int,
+	fsm *FSM,
+	b int,
+	opts ...Option,
+) (Actor, error) {
+	if err := fsm.validate(); err != nil {
+		return nil, err
+	}
+
+	return NewBehaviorActor(ctx, name, buffer, &fsmBehavior{fsm: fsm}, b, opts...)
+}
+
+// PreStart enters the initial or persisted state
+func (f *fsmBehavior) PreStart(ctx ActorContext) error {
+	s := f.fsm.initial
+
+	if f.fsm.persist {
+		var snap fsmSnapshot
+
+		err := ctx.Self().LoadLatestSnapshot(&snap)
+		switch {
+		case err == nil:
+			if _, ok := f.fsm.states[snap.State]; ok {
+				s = snap.State
+			}
+		case err != ErrSnapshotNotFound:
+			return err
+		}
+	}
+
+	f.enter(ctx, "", s)
+
+	return nil
+}
+
+// PostStop stops timer of current state
+func (f *fsmBehavior) PostStop(ctx ActorContext) {
+	f.stopTimer()
+}
+
+// Receive passes msg to handler of current state, transits to returned
+// state
+func (f *fsmBehavior) Receive(ctx ActorContext, msg interface{}) {
+	if t, ok := msg.(fsmTimeout); ok {
+		if t.gen != f.gen {
+			// timer fired before the state was left
+			return
+		}
+
+		msg = t.msg
+	}
+
+	next := f.fsm.states[f.state].handler(ctx, msg)
+	if next == "" || next == f.state {
+		return
+	}
+
+	if _, ok := f.fsm.states[next]; !ok {
+		la := ctx.Self().(*localActor)
+		la.log().Error(
+			"fsm state undeclared",
+			zap.String("service", serviceName),
+			zap.String("actor", la.name),
+			zap.String("uuid", la.uuid),
+			zap.String("state", string(f.state)),
+			zap.String("next", string(next)),
+		)
+
+		return
+	}
+
+	from := f.state
+	if exit := f.fsm.states[from].exit; exit != nil {
+		exit(ctx, next)
+	}
+
+	f.enter(ctx, from, next)
+}
+
+// enter sets current state to s, starts its timer, persists and publishes
+// the transition
+func (f *fsmBehavior) enter(ctx ActorContext, from, s State) {
+	st := f.fsm.states[s]
+	self := ctx.Self()
+	la := self.(*localActor)
+
+	f.stopTimer()
+	f.gen++
+	f.state = s
+
+	if st.timeout > 0 {
+		t := fsmTimeout{gen: f.gen, msg: st.msg}
+
+		// pushed into mailbox directly, thus timeout is never wrapped into
+		// envelope, deduplicated or stored by durable mailbox
+		f.timer = time.AfterFunc(st.timeout, func() { la.push(la.ctx, t) })
+	}
+
+	if f.fsm.persist {
+		if err := self.SaveSnapshot(fsmSnapshot{State: s}); err != nil {
+			la.log().Error(
+				"fsm state persist error",
+				zap.String("service", serviceName),
+				zap.String("actor", la.name),
+				zap.String("uuid", la.uuid),
+				zap.String("state", string(s)),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
+
+	la.log().Debug(
+		"fsm transition",
+		zap.String("service", serviceName),
+		zap.String("actor", la.name),
+		zap.String("uuid", la.uuid),
+		zap.String("from", string(from)),
+		zap.String("to", string(s)),
+	)
+
+	publish(Transition{
+		Actor: la.name,
+		UUID:  la.uuid,
+		From:  from,
+		To:    s,
+		Time:  time.Now(),
+	})
+
+	if st.enter != nil {
+		st.enter(ctx, from)
+	}
+}
+
+// stopTimer stops timer of current state
+func (f *fsmBehavior) stopTimer() {
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+}
@@ -0,0 +1,195 @@
+package actor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// unwrap acks envelope delivered by durable mailbox, returns its message
+func unwrap(msg interface{}) interface{} {
+	if env, ok := msg.(*actor.Envelope); ok {
+		env.Ack()
+		return env.Message
+	}
+
+	return msg
+}
+
+// turnstile unlocks by coin, locks by push or once unlocked for a while
+func turnstile(events chan string, timeout time.Duration) *actor.FSM {
+	return actor.NewFSM("locked").
+		State("locked", func(ctx actor.ActorContext, msg interface{}) actor.State {
+			if unwrap(msg) == "coin" {
+				return "unlocked"
+			}
+
+			return ""
+		}).
+		State("unlocked", func(ctx actor.ActorContext, msg interface{}) actor.State {
+			msg = unwrap(msg)
+
+			switch msg.(type) {
+			case actor.StateTimeout:
+				events <- "timeout"
+				return "locked"
+			case string:
+				if msg == "push" {
+					return "locked"
+				}
+			}
+
+			return "unlocked"
+		}).
+		OnEnter("unlocked", func(ctx actor.ActorContext, from actor.State) {
+			events <- "enter unlocked from " + string(from)
+		}).
+		OnExit("unlocked", func(ctx actor.ActorContext, to actor.State) {
+			events <- "exit unlocked to " + string(to)
+		}).
+		Timeout("unlocked", timeout, nil)
+}
+
+// expectTransitions receives transitions of actor name from sub
+func expectTransitions(t *testing.T, sub *actor.Subscription, name string, expect ...string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+
+	for _, e := range expect {
+		for {
+			var ev interface{}
+
+			select {
+			case ev = <-sub.C:
+			case <-timeout:
+				t.Fatal(actorTimeoutErr)
+			}
+
+			tr, ok := ev.(actor.Transition)
+			if !ok || tr.Actor != name {
+				continue
+			}
+
+			if got := string(tr.From) + ">" + string(tr.To); got != e {
+				t.Fatalf("expecting: transition %s, receiving: %s", e, got)
+			}
+
+			break
+		}
+	}
+}
+
+func TestFSM(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	events := make(chan string, 10)
+	fsm := turnstile(events, 50*time.Millisecond)
+
+	tc := createTestCase(1, 10, -1)[0]
+	act, err := actor.NewFSMActor(ctx, tc.name, tc.buffer, fsm, tc.backup)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	for _, msg := range []string{"push", "coin", "coin", "push"} {
+		act.Send(msg)
+	}
+
+	expectTransitions(t, sub, tc.name,
+		">locked", "locked>unlocked", "unlocked>locked")
+	expectEvents(t, events,
+		"enter unlocked from locked", "exit unlocked to locked")
+
+	// unlocked state times out
+	act.Send("coin")
+
+	expectTransitions(t, sub, tc.name, "locked>unlocked", "unlocked>locked")
+	expectEvents(t, events,
+		"enter unlocked from locked", "timeout", "exit unlocked to locked")
+}
+
+func TestFSMDurableMailbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	events := make(chan string, 10)
+	fsm := turnstile(events, 50*time.Millisecond)
+
+	tc := createTestCase(1, 10, 0)[0]
+	act, err := actor.NewFSMActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		fsm,
+		tc.backup,
+		actor.WithBackup(actor.NewMemoryBackup().Store),
+		actor.WithDurableMailbox(0),
+		actor.WithDedup(actor.DedupConfig{}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	act.Send("coin")
+
+	// state timeout bypasses durable mailbox
+	expectTransitions(t, sub, tc.name, ">locked", "locked>unlocked", "unlocked>locked")
+	expectEvents(t, events,
+		"enter unlocked from locked", "timeout", "exit unlocked to locked")
+}
+
+func TestFSMPersist(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	mem := actor.NewMemoryBackup()
+	fsm := turnstile(make(chan string, 10), time.Hour).Persist()
+
+	tc := createTestCase(1, 10, 0)[0]
+
+	actCtx, actCancel := context.WithCancel(ctx)
+	act, err := actor.NewFSMActor(
+		actCtx, tc.name, tc.buffer, fsm, tc.backup, actor.WithBackup(mem.Store))
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	act.Send("coin")
+	expectTransitions(t, sub, tc.name, ">locked", "locked>unlocked")
+
+	actCancel()
+	waitDeregister(t, tc.name)
+
+	// actor with the same name resumes in persisted state
+	_, err = actor.NewFSMActor(
+		ctx, tc.name, tc.buffer, fsm, tc.backup, actor.WithBackup(mem.Store))
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	expectTransitions(t, sub, tc.name, ">unlocked")
+}
+
+func TestFSMUndeclaredState(t *testing.T) {
+	tc := createTestCase(1, 10, -1)[0]
+
+	fsm := actor.NewFSM("idle").OnEnter("idle", func(actor.ActorContext, actor.State) {})
+
+	_, err := actor.NewFSMActor(context.Background(), tc.name, tc.buffer, fsm, tc.backup)
+	if err != actor.ErrFSMState {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrFSMState, err)
+	}
+}
@@ -1,11 +1,16 @@
 module github.com/vsdmars/actor
 
+go 1.21
+
 require (
 	github.com/eapache/go-resiliency v1.1.0
 	github.com/google/uuid v1.1.1
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/mattn/go-sqlite3 v1.10.0
+	go.uber.org/zap v1.9.1
+)
+
+require (
 	go.uber.org/atomic v1.3.2 // indirect
 	go.uber.org/multierr v1.1.0 // indirect
-	go.uber.org/zap v1.9.1
 )
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"os"
+	"sync"
+)
+
+var (
+	rootLock sync.RWMutex
+	root     string // empty: working directory
+)
+
+// SetRoot sets root directory contains backup db and rotate db directories
+//
+// reset to working directory by passing in empty string
+func SetRoot(dir string) {
+	defer rootLock.Unlock()
+	rootLock.Lock()
+
+	root = dir
+}
+
+func rootDir() string {
+	defer rootLock.RUnlock()
+	rootLock.RLock()
+
+	if root != "" {
+		return root
+	}
+
+	currentDir, _ := os.Getwd()
+	return currentDir
+}
+
+var (
+	hookLock   sync.RWMutex
+	rotateHook func(name, uuid string)
+)
+
+// SetRotateHook sets func called after backup rows are rotated
+//
+// nil removes the hook
+func SetRotateHook(f func(name, uuid string)) {
+	defer hookLock.Unlock()
+	hookLock.Lock()
+
+	rotateHook = f
+}
+
+func rotated(name, uuid string) {
+	hookLock.RLock()
+	f := rotateHook
+	hookLock.RUnlock()
+
+	if f != nil {
+		f(name, uuid)
+	}
+}
@@ -0,0 +1,103 @@
+// +build database
+
+package db
+
+import (
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+var (
+	insertSeen = `INSERT OR REPLACE INTO dedup(id, time) VALUES (?, ?) ;`
+	selectSeen = `SELECT id, time FROM dedup WHERE time >= ? ;`
+	expireSeen = `DELETE FROM dedup WHERE time < ? ;`
+)
+
+var dedup_schema = `
+CREATE TABLE if not exists dedup(
+    id text PRIMARY KEY,
+    time INTEGER
+);
+`
+
+// database ORM type
+type seen struct {
+	ID   string `db:"id"`
+	Time int64  `db:"time"` // unix nano
+}
+
+// MarkSeen records message id for deduplication
+func (s *Sqlite) MarkSeen(id string, t time.Time) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	_, err := s.db.ExecContext(s.ctx, insertSeen, id, t.UnixNano())
+
+	return err
+}
+
+// Seen returns message ids recorded since, by actor instances with the same
+// name
+//
+// expired message ids of this instance are removed
+func (s *Sqlite) Seen(since time.Time) (map[string]time.Time, error) {
+	if s.db == nil {
+		return nil, ErrDbClosed
+	}
+
+	if _, err := s.db.ExecContext(s.ctx, expireSeen, since.UnixNano()); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]time.Time)
+
+	if err := selectSeenIDs(s.db, since, ids); err != nil {
+		return nil, err
+	}
+
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbFile := range dbFiles {
+		db, err := openReadOnly(dbFile)
+		if err != nil {
+			continue
+		}
+
+		// db created before dedup support has no dedup table
+		if err := selectSeenIDs(db, since, ids); err != nil {
+			l.GetLog().Debug(
+				"dedup query error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("file", dbFile),
+				zap.String("error", err.Error()),
+			)
+		}
+
+		db.Close()
+	}
+
+	return ids, nil
+}
+
+func selectSeenIDs(db *sqlx.DB, since time.Time, ids map[string]time.Time) error {
+	var rows []seen
+	if err := db.Select(&rows, selectSeen, since.UnixNano()); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		ids[r.ID] = time.Unix(0, r.Time)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package db
+
+import "errors"
+
+var (
+	// ErrNoSqlite sqlite backup is not compiled in
+	ErrNoSqlite = errors.New("sqlite backup requires build tag 'database'")
+	// ErrSnapshotNotFound no snapshot stored for actor
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	// ErrSnapshotChecksum snapshot fails checksum verification
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
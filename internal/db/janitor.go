@@ -0,0 +1,210 @@
+// +build database
+
+package db
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// sqlite side files removed along with db file
+var sideFiles = []string{"-journal", "-wal", "-shm"}
+
+// rotated db file considered by disk quota
+type rotatedFile struct {
+	file    string
+	size    int64
+	modTime time.Time
+}
+
+// Clean removes backup db files selected by retention policy
+//
+// Live db of running actors are never removed. Live db of ended or crashed
+// actors hold snapshots, durable mailbox, dead letters, dedup ids and outbox
+// recovered by actors with the same name, they are removed only if
+// policy.RemoveEnded, and never while holding pending mailbox or outbox
+// messages.
+//
+// returns removed db files
+func Clean(ctx context.Context, policy Retention) ([]string, error) {
+	infos, err := ListActors(ctx, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	var removed []string
+	var candidates []rotatedFile
+	var total int64
+
+	remove := func(file string) bool {
+		if err := removeDB(file); err != nil {
+			l.GetLog().Error(
+				"backup db remove error",
+				zap.String("service", serviceName),
+				zap.String("file", file),
+				zap.String("error", err.Error()),
+			)
+
+			return false
+		}
+
+		removed = append(removed, file)
+		return true
+	}
+
+	// actor ended, or crashed without end time, longer than MaxAge
+	expired := func(info ActorInfo) bool {
+		if !info.EndTime.IsZero() {
+			return now.Sub(info.EndTime) > policy.MaxAge
+		}
+
+		if policy.Running[info.UUID] {
+			return false
+		}
+
+		written, ok := lastWrite(info.File)
+		return ok && now.Sub(written) > policy.MaxAge
+	}
+
+	for _, info := range infos {
+		if policy.RemoveEnded &&
+			policy.MaxAge > 0 &&
+			expired(info) &&
+			!pending(ctx, info.File) {
+
+			for _, file := range info.Rotated {
+				remove(file)
+			}
+
+			if info.File != "" {
+				remove(info.File)
+			}
+
+			continue
+		}
+
+		if fi, err := os.Stat(info.File); err == nil {
+			total += fi.Size()
+		}
+
+		rotated := info.Rotated
+		if policy.MaxRotated > 0 && len(rotated) > policy.MaxRotated {
+			for _, file := range rotated[:len(rotated)-policy.MaxRotated] {
+				remove(file)
+			}
+
+			rotated = rotated[len(rotated)-policy.MaxRotated:]
+		}
+
+		for _, file := range rotated {
+			fi, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+
+			if policy.MaxAge > 0 && now.Sub(fi.ModTime()) > policy.MaxAge {
+				remove(file)
+				continue
+			}
+
+			total += fi.Size()
+			candidates = append(
+				candidates, rotatedFile{file, fi.Size(), fi.ModTime()})
+		}
+	}
+
+	if policy.MaxTotalBytes > 0 && total > policy.MaxTotalBytes {
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].modTime.Before(candidates[j].modTime)
+		})
+
+		for _, c := range candidates {
+			if total <= policy.MaxTotalBytes {
+				break
+			}
+
+			if remove(c.file) {
+				total -= c.size
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// pending reports whether db holds pending mailbox or outbox messages, db
+// can not be inspected is considered pending
+func pending(ctx context.Context, file string) bool {
+	if file == "" {
+		return false
+	}
+
+	db, err := openReadOnly(file)
+	if err != nil {
+		return true
+	}
+	defer db.Close()
+
+	for _, query := range []string{countPending, countOutbox} {
+		var count int
+		if err := db.GetContext(ctx, &count, query); err != nil {
+			// db created before mailbox or outbox support has no such table
+			if strings.Contains(err.Error(), "no such table") {
+				continue
+			}
+
+			return true
+		}
+
+		if count > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lastWrite returns the latest modification time of db file and its side
+// files, false if db file does not exist
+func lastWrite(file string) (time.Time, bool) {
+	if file == "" {
+		return time.Time{}, false
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	written := fi.ModTime()
+	for _, suffix := range sideFiles {
+		if fi, err := os.Stat(file + suffix); err == nil && fi.ModTime().After(written) {
+			written = fi.ModTime()
+		}
+	}
+
+	return written, true
+}
+
+func removeDB(file string) error {
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+
+	for _, suffix := range sideFiles {
+		if err := os.Remove(file + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+// +build database
+
+package db
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	mailPending = "pending"
+	mailDead    = "dead"
+)
+
+var (
+	insertMail     = `INSERT OR IGNORE INTO mailbox(id, time, codec, payload, attempts, status, reason) VALUES (:id, :time, :codec, :payload, :attempts, :status, :reason) ;`
+	deleteMail     = `DELETE FROM mailbox WHERE id = ? AND status = 'pending' ;`
+	increaseMail   = `UPDATE mailbox SET attempts = attempts + 1 WHERE id = ? ;`
+	selectAttempts = `SELECT attempts FROM mailbox WHERE id = ? ;`
+	deadMail       = `UPDATE mailbox SET status = 'dead', reason = ? WHERE id = ? ;`
+	selectMail     = `SELECT id, time, codec, payload, attempts, status, reason FROM mailbox WHERE status = ? ORDER BY time, rowid ;`
+	deletePending  = `DELETE FROM mailbox WHERE status = 'pending' ;`
+	countPending   = `SELECT COUNT(*) FROM mailbox WHERE status = 'pending' ;`
+)
+
+var mailbox_schema = `
+CREATE TABLE if not exists mailbox(
+    id text PRIMARY KEY,
+    time text,
+    codec text,
+    payload blob,
+    attempts INTEGER,
+    status text,
+    reason text
+);
+`
+
+// database ORM type
+type mail struct {
+	ID       string `db:"id"`
+	Time     string `db:"time"`
+	Codec    string `db:"codec"`
+	Payload  []byte `db:"payload"`
+	Attempts int    `db:"attempts"`
+	Status   string `db:"status"`
+	Reason   string `db:"reason"`
+}
+
+func (m mail) toMail() Mail {
+	t, _ := time.Parse(time.RFC3339Nano, m.Time)
+
+	return Mail{
+		ID:       m.ID,
+		Time:     t,
+		Codec:    m.Codec,
+		Payload:  m.Payload,
+		Attempts: m.Attempts,
+		Reason:   m.Reason,
+	}
+}
+
+// Enqueue stores message into durable mailbox before delivery
+//
+// message is recorded as delivered once
+func (s *Sqlite) Enqueue(id, codec string, payload []byte) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	_, err := s.db.NamedExecContext(
+		s.ctx,
+		insertMail,
+		mail{
+			ID:       id,
+			Time:     time.Now().Format(time.RFC3339Nano),
+			Codec:    codec,
+			Payload:  payload,
+			Attempts: 1,
+			Status:   mailPending,
+		},
+	)
+	if err != nil {
+		l.GetLog().Error(
+			"mailbox enqueue error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	return nil
+}
+
+// Ack removes processed message from durable mailbox
+func (s *Sqlite) Ack(id string) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	_, err := s.db.ExecContext(s.ctx, deleteMail, id)
+
+	return err
+}
+
+// Attempt increases message's delivery attempts
+//
+// returns delivery attempts
+func (s *Sqlite) Attempt(id string) (int, error) {
+	if s.db == nil {
+		return 0, ErrDbClosed
+	}
+
+	if _, err := s.db.ExecContext(s.ctx, increaseMail, id); err != nil {
+		return 0, err
+	}
+
+	var attempts int
+	err := s.db.QueryRowxContext(s.ctx, selectAttempts, id).Scan(&attempts)
+
+	return attempts, err
+}
+
+// DeadLetter moves message into dead letter queue
+func (s *Sqlite) DeadLetter(id, reason string) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	// Do not use context call, actor may be in cancel state
+	_, err := s.db.Exec(deadMail, reason, id)
+	if err != nil {
+		l.GetLog().Error(
+			"mailbox dead letter error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+	}
+
+	return err
+}
+
+// Recover claims unacknowledged messages left by previous actor instances
+// with the same name
+//
+// claimed messages are moved into this instance's db, ordered by enqueue
+// time
+func (s *Sqlite) Recover() ([]Mail, error) {
+	if s.db == nil {
+		return nil, ErrDbClosed
+	}
+
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return nil, err
+	}
+
+	var mails []Mail
+
+	for _, dbFile := range dbFiles {
+		claimed, err := s.claim(dbFile)
+		if err != nil {
+			l.GetLog().Error(
+				"mailbox recover error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("file", dbFile),
+				zap.String("error", err.Error()),
+			)
+
+			continue
+		}
+
+		mails = append(mails, claimed...)
+	}
+
+	return mails, nil
+}
+
+// claim moves pending messages of db file into this instance's db
+func (s *Sqlite) claim(dbFile string) ([]Mail, error) {
+	db, err := sqlx.Open(
+		"sqlite3",
+		fmt.Sprintf(dbDSN, dbFile, cacheMode[PRIVATE], journalMode[DELETE]),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	pending, err := queryMail(db, mailPending)
+	if err != nil || len(pending) == 0 {
+		// db created before mailbox support has no mailbox table
+		return nil, nil
+	}
+
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	mails := make([]Mail, 0, len(pending))
+
+	for _, m := range pending {
+		if _, err := tx.NamedExecContext(s.ctx, insertMail, m); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		mails = append(mails, m.toMail())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// crash before delete redelivers messages again, at-least-once
+	if _, err := db.ExecContext(s.ctx, deletePending); err != nil {
+		return nil, err
+	}
+
+	return mails, nil
+}
+
+// DeadLetters returns dead letters of actor instances with the same name
+func (s *Sqlite) DeadLetters() ([]Mail, error) {
+	if s.db == nil {
+		return nil, ErrDbClosed
+	}
+
+	dead, err := queryMail(s.db, mailDead)
+	if err != nil {
+		return nil, err
+	}
+
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbFile := range dbFiles {
+		db, err := openReadOnly(dbFile)
+		if err != nil {
+			continue
+		}
+
+		d, _ := queryMail(db, mailDead)
+		db.Close()
+
+		dead = append(dead, d...)
+	}
+
+	mails := make([]Mail, 0, len(dead))
+	for _, m := range dead {
+		mails = append(mails, m.toMail())
+	}
+
+	return mails, nil
+}
+
+func queryMail(db *sqlx.DB, status string) ([]mail, error) {
+	var mails []mail
+	err := db.Select(&mails, selectMail, status)
+
+	return mails, err
+}
+
+// siblingDBs returns live db files of other actor instances with the same
+// name
+func (s *Sqlite) siblingDBs() ([]string, error) {
+	// name may contain glob meta characters, matched by regexp instead
+	dbFiles, err := filepath.Glob(path.Join(dbDir(backupDB), "*.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	re := regexp.MustCompile(
+		fmt.Sprintf(`^%s_%s\.db$`, regexp.QuoteMeta(s.name), uuidPattern))
+
+	var siblings []string
+
+	for _, dbFile := range dbFiles {
+		base := filepath.Base(dbFile)
+		if !re.MatchString(base) ||
+			base == fmt.Sprintf("%s_%s.db", s.name, s.uuid) {
+			continue
+		}
+
+		siblings = append(siblings, dbFile)
+	}
+
+	return siblings, nil
+}
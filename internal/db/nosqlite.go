@@ -5,24 +5,11 @@ package db
 import (
 	"context"
 	"time"
-
-	. "github.com/vsdmars/actor/internal/logger"
-	"go.uber.org/zap"
 )
 
-// NewSqlite returns init. Sqlite instance
-//
-// ctx: context.Context
-//
-// name: actor name
-//
-// uuid: actor uuid
+// NewSqlite requires sqlite compiled in, returns ErrNoSqlite
 //
-// jmode: journal mode
-//
-// cmode: cache mode
-//
-// rcnt: 0: no rotation, >0: preserve number of records then rotate.
+// build with tag 'database' to enable sqlite backup
 func NewSqlite(
 	ctx context.Context, // caller's context
 	name string, // actor name
@@ -30,60 +17,125 @@ func NewSqlite(
 	jmode int, // journal mode
 	cmode int, // cache mode
 	rcnt int, // rotate count
-	period int, // recycle period in seconds
+	period time.Duration, // rotate check period
 ) (*Sqlite, error) {
-	return &Sqlite{
-		ctx:     ctx,
-		name:    name,
-		uuid:    uuid,
-		journal: jmode,
-		cache:   cmode,
-		rotate:  rcnt,
-		db:      nil,
-	}, nil
-}
-
-func (s *Sqlite) Close() {
-	GetLog().Debug(
-		"Close noop",
-		zap.String("service", serviceName),
-		zap.String("actor", s.name),
-		zap.String("uuid", s.uuid),
-	)
+	return nil, ErrNoSqlite
 }
 
+func (s *Sqlite) Close() {}
+
 func (s *Sqlite) Insert(msg string) error {
-	GetLog().Debug(
-		"Insert noop",
-		zap.String("service", serviceName),
-		zap.String("actor", s.name),
-		zap.String("uuid", s.uuid),
-		zap.String("message", msg),
-	)
+	return ErrNoSqlite
+}
 
-	return nil
+func (s *Sqlite) InsertBatch(msgs []string) error {
+	return ErrNoSqlite
 }
 
 func (s *Sqlite) Start(startTime time.Time) error {
-	GetLog().Debug(
-		"Start noop",
-		zap.String("service", serviceName),
-		zap.String("actor", s.name),
-		zap.String("uuid", s.uuid),
-		zap.String("start time", startTime.String()),
-	)
-
-	return nil
+	return ErrNoSqlite
 }
 
 func (s *Sqlite) Stop(endTime time.Time) error {
-	GetLog().Debug(
-		"Stop noop",
-		zap.String("service", serviceName),
-		zap.String("actor", s.name),
-		zap.String("uuid", s.uuid),
-		zap.String("end time", endTime.String()),
-	)
-
-	return nil
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) SaveSnapshot(codec string, state []byte, keep int) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) LoadLatestSnapshot() (string, []byte, error) {
+	return "", nil, ErrNoSqlite
+}
+
+// ReadBackup requires sqlite compiled in
+func ReadBackup(
+	ctx context.Context,
+	name, uuid string,
+	filter Filter,
+	fn func(Record) error,
+) error {
+	return ErrNoSqlite
+}
+
+// Follow requires sqlite compiled in
+func Follow(
+	ctx context.Context,
+	name, uuid string,
+	cur *Cursor,
+	fn func(Record) error,
+) error {
+	return ErrNoSqlite
+}
+
+// ListActors requires sqlite compiled in
+func ListActors(ctx context.Context, name, uuid string) ([]ActorInfo, error) {
+	return nil, ErrNoSqlite
+}
+
+// VerifyFile requires sqlite compiled in
+func VerifyFile(ctx context.Context, file string) error {
+	return ErrNoSqlite
+}
+
+// CompactFile requires sqlite compiled in
+func CompactFile(ctx context.Context, file string) error {
+	return ErrNoSqlite
+}
+
+// Clean requires sqlite compiled in
+func Clean(ctx context.Context, policy Retention) ([]string, error) {
+	return nil, ErrNoSqlite
+}
+
+func (s *Sqlite) Enqueue(id, codec string, payload []byte) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) Ack(id string) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) Attempt(id string) (int, error) {
+	return 0, ErrNoSqlite
+}
+
+func (s *Sqlite) DeadLetter(id, reason string) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) Recover() ([]Mail, error) {
+	return nil, ErrNoSqlite
+}
+
+func (s *Sqlite) DeadLetters() ([]Mail, error) {
+	return nil, ErrNoSqlite
+}
+
+func (s *Sqlite) MarkSeen(id string, t time.Time) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) Seen(since time.Time) (map[string]time.Time, error) {
+	return nil, ErrNoSqlite
+}
+
+func (s *Sqlite) SaveOutbox(codec string, state []byte, keep int, out []Outbox) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) ClaimOutbox() error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) PendingOutbox() ([]Outbox, error) {
+	return nil, ErrNoSqlite
+}
+
+func (s *Sqlite) OutboxAttempt(id string) error {
+	return ErrNoSqlite
+}
+
+func (s *Sqlite) OutboxDone(id string) error {
+	return ErrNoSqlite
 }
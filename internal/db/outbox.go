@@ -0,0 +1,255 @@
+// +build database
+
+package db
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+var (
+	insertOutbox  = `INSERT OR IGNORE INTO outbox(id, time, target, codec, payload, attempts) VALUES (:id, :time, :target, :codec, :payload, :attempts) ;`
+	selectOutbox  = `SELECT id, time, target, codec, payload, attempts FROM outbox ORDER BY time, rowid ;`
+	attemptOutbox = `UPDATE outbox SET attempts = attempts + 1 WHERE id = ? ;`
+	deleteOutbox  = `DELETE FROM outbox WHERE id = ? ;`
+	clearOutbox   = `DELETE FROM outbox ;`
+	countOutbox   = `SELECT COUNT(*) FROM outbox ;`
+)
+
+var outbox_schema = `
+CREATE TABLE if not exists outbox(
+    id text PRIMARY KEY,
+    time text,
+    target text,
+    codec text,
+    payload blob,
+    attempts INTEGER
+);
+`
+
+// database ORM type
+type outbox struct {
+	ID       string `db:"id"`
+	Time     string `db:"time"`
+	Target   string `db:"target"`
+	Codec    string `db:"codec"`
+	Payload  []byte `db:"payload"`
+	Attempts int    `db:"attempts"`
+}
+
+func (o outbox) toOutbox() Outbox {
+	t, _ := time.Parse(time.RFC3339Nano, o.Time)
+
+	return Outbox{
+		ID:       o.ID,
+		Time:     t,
+		Target:   o.Target,
+		Codec:    o.Codec,
+		Payload:  o.Payload,
+		Attempts: o.Attempts,
+	}
+}
+
+// SaveOutbox stores state snapshot and outgoing messages in a single
+// transaction
+//
+// state: serialized state, nil: outgoing messages only
+//
+// keep: <= 0: preserve all snapshots, > 0: preserve number of latest snapshots
+// across actor instances with the same name
+func (s *Sqlite) SaveOutbox(codec string, state []byte, keep int, out []Outbox) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db transaction error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	if state != nil {
+		if err := s.saveSnapshot(tx, codec, state, keep); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339Nano)
+
+	for _, o := range out {
+		_, err := tx.NamedExecContext(
+			s.ctx,
+			insertOutbox,
+			outbox{
+				ID:      o.ID,
+				Time:    now,
+				Target:  o.Target,
+				Codec:   o.Codec,
+				Payload: o.Payload,
+			},
+		)
+		if err != nil {
+			l.GetLog().Error(
+				"backup db insert outbox error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("error", err.Error()),
+			)
+
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		l.GetLog().Error(
+			"backup db commit error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	if state != nil {
+		s.retainSiblingSnapshots(keep)
+	}
+
+	return nil
+}
+
+// ClaimOutbox claims undelivered outgoing messages left by previous actor
+// instances with the same name
+//
+// claimed messages are moved into this instance's db
+func (s *Sqlite) ClaimOutbox() error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return err
+	}
+
+	for _, dbFile := range dbFiles {
+		if err := s.claimOutbox(dbFile); err != nil {
+			l.GetLog().Error(
+				"outbox claim error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("file", dbFile),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
+
+	return nil
+}
+
+// PendingOutbox returns undelivered outgoing messages of this instance in
+// record order
+func (s *Sqlite) PendingOutbox() ([]Outbox, error) {
+	if s.db == nil {
+		return nil, ErrDbClosed
+	}
+
+	var rows []outbox
+	if err := s.db.SelectContext(s.ctx, &rows, selectOutbox); err != nil {
+		return nil, err
+	}
+
+	out := make([]Outbox, 0, len(rows))
+	for _, o := range rows {
+		out = append(out, o.toOutbox())
+	}
+
+	return out, nil
+}
+
+// claimOutbox moves outgoing messages of db file into this instance's db
+func (s *Sqlite) claimOutbox(dbFile string) error {
+	db, err := sqlx.Open(
+		"sqlite3",
+		fmt.Sprintf(dbDSN, dbFile, cacheMode[PRIVATE], journalMode[DELETE]),
+	)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var rows []outbox
+	if err := db.SelectContext(s.ctx, &rows, selectOutbox); err != nil {
+		// db created before outbox support has no outbox table
+		if strings.Contains(err.Error(), "no such table") {
+			return nil
+		}
+
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range rows {
+		if _, err := tx.NamedExecContext(s.ctx, insertOutbox, o); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// crash before delete delivers messages again, at-least-once
+	_, err = db.ExecContext(s.ctx, clearOutbox)
+
+	return err
+}
+
+// OutboxAttempt records a failed delivery attempt of outgoing message
+func (s *Sqlite) OutboxAttempt(id string) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	_, err := s.db.ExecContext(s.ctx, attemptOutbox, id)
+
+	return err
+}
+
+// OutboxDone removes delivered outgoing message
+func (s *Sqlite) OutboxDone(id string) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	_, err := s.db.ExecContext(s.ctx, deleteOutbox, id)
+
+	return err
+}
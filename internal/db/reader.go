@@ -0,0 +1,464 @@
+// +build database
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const uuidPattern = `[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`
+
+var (
+	selectActor = `SELECT uuid, name, start_time, COALESCE(end_time, '') AS end_time FROM actor WHERE uuid = ? ;`
+	selectLog   = `SELECT seq, time, message FROM log WHERE seq >= ? AND seq <= ? ORDER BY seq ;`
+
+	integrityCheck = `PRAGMA integrity_check ;`
+	vacuum         = `VACUUM ;`
+)
+
+type (
+	// rotated db file with its rotation sequence
+	rotateFile struct {
+		seq  int
+		file string
+	}
+
+	// db files belong to one actor instance
+	backupFiles struct {
+		name    string
+		uuid    string
+		start   string
+		end     string
+		live    string
+		rotated []rotateFile
+	}
+)
+
+// ReadBackup iterates backed up messages of actor in order
+//
+// Messages stored in rotate db are iterated before the ones in live db.
+//
+// name: actor name
+//
+// uuid: actor uuid, empty string iterates all actor instances with the name
+// ordered by actor start time
+//
+// filter: selects messages by time range and sequence
+//
+// fn: called for each message, iteration stops if fn returns error
+func ReadBackup(
+	ctx context.Context,
+	name, uuid string,
+	filter Filter,
+	fn func(Record) error,
+) error {
+	sets, err := findBackupFiles(ctx, name, uuid)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		files := make([]string, 0, len(set.rotated)+1)
+		for _, r := range set.rotated {
+			files = append(files, r.file)
+		}
+
+		if set.live != "" {
+			files = append(files, set.live)
+		}
+
+		for _, file := range files {
+			if err := readLog(ctx, set.name, set.uuid, file, filter, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Follow iterates messages backed up after cur in order, advances cur
+//
+// Rotate db read completely before are skipped, thus it is cheap to poll.
+// Messages moved into rotate db since the last poll are read from rotate db.
+func Follow(
+	ctx context.Context,
+	name, uuid string,
+	cur *Cursor,
+	fn func(Record) error,
+) error {
+	sets, err := findBackupFiles(ctx, name, uuid)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		records, err := cur.read(ctx, set)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range records {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// read returns messages of actor instance after cursor ordered by sequence
+//
+// Sequences of actor instance are contiguous, messages after a missing
+// sequence of running actor are read again by the next poll, the missing one
+// may be moving into rotate db.
+func (cur *Cursor) read(ctx context.Context, set *backupFiles) ([]Record, error) {
+	var records []Record
+
+	filter := Filter{FromSeq: cur.seq[set.uuid] + 1}
+	collect := func(r Record) error {
+		records = append(records, r)
+		return nil
+	}
+
+	var rotated []rotateFile
+	readRotated := func(set *backupFiles) {
+		for _, r := range set.rotated {
+			if cur.done[r.file] {
+				continue
+			}
+
+			// rotate db being created is read by the next poll
+			if err := readLog(ctx, set.name, set.uuid, r.file, filter, collect); err != nil {
+				continue
+			}
+
+			rotated = append(rotated, r)
+		}
+	}
+
+	readRotated(set)
+
+	if set.live != "" {
+		if err := readLog(ctx, set.name, set.uuid, set.live, filter, collect); err != nil {
+			return nil, err
+		}
+
+		// messages rotated while live db was read
+		again, err := findBackupFiles(ctx, set.name, set.uuid)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range again {
+			readRotated(s)
+			set = s
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Seq < records[j].Seq
+	})
+
+	// message copied into rotate db may be read from live db as well
+	last := cur.seq[set.uuid]
+	result := records[:0]
+	for _, r := range records {
+		if r.Seq <= last {
+			continue
+		}
+
+		if r.Seq != last+1 && last != 0 && set.end == "" {
+			break
+		}
+
+		result = append(result, r)
+		last = r.Seq
+	}
+
+	cur.seq[set.uuid] = last
+
+	// rotations are serialized, only the latest rotate db of running actor
+	// may be still written
+	latest := ""
+	if n := len(set.rotated); n > 0 && set.end == "" {
+		latest = set.rotated[n-1].file
+	}
+
+	for _, r := range rotated {
+		if r.file == latest {
+			continue
+		}
+
+		done := true
+		for _, rec := range records {
+			if rec.File == r.file && rec.Seq > last {
+				done = false
+				break
+			}
+		}
+
+		cur.done[r.file] = done
+	}
+
+	return result, nil
+}
+
+// ListActors returns actor instances stored in backup db ordered by start time
+//
+// empty name or uuid matches any actor name or uuid
+func ListActors(ctx context.Context, name, uuid string) ([]ActorInfo, error) {
+	sets, err := findBackupFiles(ctx, name, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ActorInfo, 0, len(sets))
+
+	for _, set := range sets {
+		info := ActorInfo{
+			Name: set.name,
+			UUID: set.uuid,
+			File: set.live,
+		}
+
+		info.StartTime, _ = time.Parse(time.RFC3339, set.start)
+		info.EndTime, _ = time.Parse(time.RFC3339, set.end)
+
+		for _, r := range set.rotated {
+			info.Rotated = append(info.Rotated, r.file)
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// VerifyFile runs sqlite integrity check on db file
+func VerifyFile(ctx context.Context, file string) error {
+	db, err := openReadOnly(file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var results []string
+	if err := db.SelectContext(ctx, &results, integrityCheck); err != nil {
+		return err
+	}
+
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf(ErrIntegrityCheck, file, strings.Join(results, "; "))
+	}
+
+	return nil
+}
+
+// CompactFile rebuilds db file to reclaim unused space
+func CompactFile(ctx context.Context, file string) error {
+	db, err := sqlx.Open(
+		"sqlite3",
+		fmt.Sprintf(dbDSN, file, cacheMode[PRIVATE], journalMode[DELETE]),
+	)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, vacuum)
+	return err
+}
+
+// findBackupFiles returns db files of actor instances ordered by start time
+//
+// empty name or uuid matches any actor name or uuid
+func findBackupFiles(ctx context.Context, name, uuid string) ([]*backupFiles, error) {
+	n, id := `.+`, uuidPattern
+	if name != "" {
+		n = regexp.QuoteMeta(name)
+	}
+
+	if uuid != "" {
+		id = regexp.QuoteMeta(uuid)
+	}
+
+	liveRe := regexp.MustCompile(fmt.Sprintf(`^(%s)_(%s)\.db$`, n, id))
+	rotateRe := regexp.MustCompile(fmt.Sprintf(`^(%s)_(%s)_(\d+)\.db$`, n, id))
+
+	sets := make(map[string]*backupFiles)
+	get := func(name, uuid string) *backupFiles {
+		if set, ok := sets[uuid]; ok {
+			return set
+		}
+
+		sets[uuid] = &backupFiles{name: name, uuid: uuid}
+		return sets[uuid]
+	}
+
+	live, err := filepath.Glob(path.Join(dbDir(backupDB), "*.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range live {
+		if m := liveRe.FindStringSubmatch(filepath.Base(file)); m != nil {
+			get(m[1], m[2]).live = file
+		}
+	}
+
+	rotated, err := filepath.Glob(path.Join(dbDir(rotateDB), "*.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range rotated {
+		if m := rotateRe.FindStringSubmatch(filepath.Base(file)); m != nil {
+			seq, _ := strconv.Atoi(m[3])
+			set := get(m[1], m[2])
+			set.rotated = append(set.rotated, rotateFile{seq, file})
+		}
+	}
+
+	result := make([]*backupFiles, 0, len(sets))
+
+	for _, set := range sets {
+		sort.Slice(set.rotated, func(i, j int) bool {
+			return set.rotated[i].seq < set.rotated[j].seq
+		})
+
+		if set.live != "" {
+			if a, err := readActor(ctx, set.live, set.uuid); err == nil {
+				set.start = a.Stime
+				set.end = a.Etime
+			}
+		}
+
+		result = append(result, set)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339, result[i].start)
+		tj, _ := time.Parse(time.RFC3339, result[j].start)
+
+		if ti.Equal(tj) {
+			return result[i].uuid < result[j].uuid
+		}
+
+		return ti.Before(tj)
+	})
+
+	return result, nil
+}
+
+func openReadOnly(file string) (*sqlx.DB, error) {
+	db, err := sqlx.Open("sqlite3", fmt.Sprintf(dbRoDSN, file))
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	return db, nil
+}
+
+// readActor returns actor row stored in live db
+func readActor(ctx context.Context, file, uuid string) (*actor, error) {
+	db, err := openReadOnly(file)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var a actor
+	if err := db.GetContext(ctx, &a, selectActor, uuid); err != nil {
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func readLog(
+	ctx context.Context,
+	name, uuid, file string,
+	filter Filter,
+	fn func(Record) error,
+) error {
+	db, err := openReadOnly(file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	fromSeq, toSeq := filter.FromSeq, filter.ToSeq
+	if toSeq <= 0 {
+		toSeq = math.MaxInt64
+	}
+
+	rows, err := db.QueryxContext(ctx, selectLog, fromSeq, toSeq)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db query error",
+			zap.String("service", serviceName),
+			zap.String("uuid", uuid),
+			zap.String("file", file),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ll log
+		if err := rows.StructScan(&ll); err != nil {
+			return err
+		}
+
+		t, err := time.Parse(time.RFC3339, ll.Time)
+		if err != nil {
+			return err
+		}
+
+		if (!filter.From.IsZero() && t.Before(filter.From)) ||
+			(!filter.To.IsZero() && t.After(filter.To)) {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(ll.Msg, &msg); err != nil {
+			return err
+		}
+
+		err = fn(Record{
+			Name:    name,
+			UUID:    uuid,
+			Seq:     int64(ll.Seq),
+			Time:    t,
+			Message: msg.Msg,
+			File:    file,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
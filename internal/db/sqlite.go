@@ -4,6 +4,8 @@ package db
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"time"
 
@@ -39,6 +42,7 @@ const (
 	backupDir = "sqlitedb"
 	rotateDir = "sqlitedb_rotate"
 	dbDSN     = "file:%s?cache=%s&_journal=%s&_sync=OFF"
+	dbRoDSN   = "file:%s?mode=ro"
 )
 
 var journalMode = map[int]string{
@@ -59,11 +63,20 @@ var (
 	insertActorStart = `INSERT INTO actor(uuid, name, start_time) VALUES (:uuid, :name, :start_time) ;`
 	updateActorEnd   = `UPDATE actor SET end_time = :end_time WHERE uuid = :uuid ;`
 	insertLog        = `INSERT INTO log(time, message) VALUES (:time, :message) ;`
+	insertSnapshot   = `INSERT INTO snapshot(time, codec, checksum, state) VALUES (:time, :codec, :checksum, :state) ;`
+	selectSnapshot   = `SELECT seq, time, codec, checksum, state FROM snapshot ORDER BY seq DESC ;`
+	retainSnapshot   = `DELETE FROM snapshot WHERE seq NOT IN (SELECT seq FROM snapshot ORDER BY seq DESC LIMIT ?) ;`
+	countSnapshot    = `SELECT COUNT(*) FROM snapshot ;`
+	selectSnapshotAt = `SELECT seq, time FROM snapshot ;`
+	deleteSnapshot   = `DELETE FROM snapshot WHERE seq = ? ;`
+	// rotated rows preserve their seq, thus seq is ordered across rotate db
+	insertRotateLog = `INSERT INTO log(seq, time, message) VALUES (:seq, :time, :message) ;`
 )
 
 var (
-	ErrDbPathIsAFile = "%s is an existing file"
-	ErrDbClosed      = errors.New("DB is closed")
+	ErrDbPathIsAFile  = "%s is an existing file"
+	ErrIntegrityCheck = "%s integrity check failed: %s"
+	ErrDbClosed       = errors.New("DB is closed")
 )
 
 var actor_schema = `
@@ -81,6 +94,15 @@ CREATE TABLE if not exists log(
     message text
 );
 `
+var snapshot_schema = `
+CREATE TABLE if not exists snapshot(
+    seq INTEGER PRIMARY KEY ASC,
+    time text,
+    codec text,
+    checksum text,
+    state blob
+);
+`
 
 // database ORM types
 type (
@@ -100,6 +122,14 @@ type (
 		Time string `db:"time"`
 		Msg  []byte `db:"message"`
 	}
+
+	snapshot struct {
+		Seq      int    `db:"seq"`
+		Time     string `db:"time"`
+		Codec    string `db:"codec"`
+		Checksum string `db:"checksum"`
+		State    []byte `db:"state"`
+	}
 )
 
 // NewSqlite returns init. Sqlite instance
@@ -122,12 +152,12 @@ func NewSqlite(
 	jmode int, // journal mode
 	cmode int, // cache mode
 	rcnt int, // rotate count
-	period int, // recycle period in seconds
+	period time.Duration, // rotate check period
 ) (*Sqlite, error) {
 
 	db, err := initDB(ctx, name, uuid, jmode, cmode, backupDB)
 	if err != nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"backup initDB error",
 			zap.String("service", serviceName),
 			zap.String("actor", name),
@@ -158,20 +188,10 @@ func initDB(
 	jmode, cmode int,
 	dbType int) (*sqlx.DB, error) {
 
-	var dbPath string
-	currentDir, _ := os.Getwd()
-
-	switch dbType {
-	case backupDB:
-		dbPath = path.Join(currentDir, backupDir)
-	case rotateDB:
-		dbPath = path.Join(currentDir, rotateDir)
-	default:
-		dbPath = path.Join(currentDir, backupDir)
-	}
+	dbPath := dbDir(dbType)
 
 	if fi, err := os.Stat(dbPath); err != nil {
-		if err := os.Mkdir(dbPath, 0700); err != nil {
+		if err := os.MkdirAll(dbPath, 0700); err != nil {
 			return nil, err
 		}
 	} else if !fi.IsDir() {
@@ -237,10 +257,25 @@ func initDB(
 	// sqlite Exec can't handle multi-statement, thus makes it different stmnt
 	db.MustExecContext(ctx, actor_schema)
 	db.MustExecContext(ctx, log_schema)
+	db.MustExecContext(ctx, snapshot_schema)
+	db.MustExecContext(ctx, mailbox_schema)
+	db.MustExecContext(ctx, dedup_schema)
+	db.MustExecContext(ctx, outbox_schema)
 
 	return db, nil
 }
 
+func dbDir(dbType int) string {
+	switch dbType {
+	case backupDB:
+		return path.Join(rootDir(), backupDir)
+	case rotateDB:
+		return path.Join(rootDir(), rotateDir)
+	default:
+		return path.Join(rootDir(), backupDir)
+	}
+}
+
 func max(x, y int) int {
 	if x < y {
 		return y
@@ -252,17 +287,18 @@ func rotate(
 	ctx context.Context,
 	name, uuid string,
 	db *sqlx.DB,
-	rcnt, period int) {
+	rcnt int,
+	period time.Duration) {
 
-	c := time.Tick(time.Duration(period) * time.Second)
+	c := time.Tick(period)
 	if c == nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"rotate error",
 			zap.String("service", serviceName),
 			zap.String("actor", name),
 			zap.String("uuid", uuid),
 			zap.String("error", fmt.Sprintf(
-				"rotate period is invalid: %d", period)),
+				"rotate period is invalid: %v", period)),
 		)
 
 		return
@@ -283,7 +319,7 @@ func rotate(
 
 		tx, err := db.BeginTxx(ctx, nil)
 		if err != nil {
-			l.Logger.Error(
+			l.GetLog().Error(
 				"backup db transaction error",
 				zap.String("service", serviceName),
 				zap.String("actor", name),
@@ -300,7 +336,7 @@ func rotate(
 		if rowCnt > rcnt {
 			rdb, err := initDB(ctx, name, uuid, DELETE, PRIVATE, rotateDB)
 			if err != nil {
-				l.Logger.Error(
+				l.GetLog().Error(
 					"rotate initDB error",
 					zap.String("service", serviceName),
 					zap.String("actor", name),
@@ -315,7 +351,7 @@ func rotate(
 
 			rows, err := tx.QueryxContext(ctx, selectSql, rcnt)
 			if err != nil {
-				l.Logger.Error(
+				l.GetLog().Error(
 					"backup db query error",
 					zap.String("service", serviceName),
 					zap.String("actor", name),
@@ -334,7 +370,7 @@ func rotate(
 			for rows.Next() {
 				var ll log
 				if err := rows.StructScan(&ll); err != nil {
-					l.Logger.Error(
+					l.GetLog().Error(
 						"backup db StructScan error",
 						zap.String("service", serviceName),
 						zap.String("actor", name),
@@ -348,11 +384,11 @@ func rotate(
 
 				_, err := rdb.NamedExecContext(
 					ctx,
-					insertLog,
+					insertRotateLog,
 					ll,
 				)
 				if err != nil {
-					l.Logger.Error(
+					l.GetLog().Error(
 						"rotate db insert error",
 						zap.String("service", serviceName),
 						zap.String("actor", name),
@@ -374,7 +410,7 @@ func rotate(
 				lastSeq,
 			)
 			if err != nil {
-				l.Logger.Error(
+				l.GetLog().Error(
 					"backup db delete error",
 					zap.String("service", serviceName),
 					zap.String("actor", name),
@@ -388,7 +424,7 @@ func rotate(
 		}
 
 		if err := tx.Commit(); err != nil {
-			l.Logger.Error(
+			l.GetLog().Error(
 				"backup db commit error",
 				zap.String("service", serviceName),
 				zap.String("actor", name),
@@ -398,6 +434,10 @@ func rotate(
 
 			return
 		}
+
+		if rowCnt > rcnt {
+			rotated(name, uuid)
+		}
 	}
 
 	for {
@@ -423,7 +463,7 @@ func (s *Sqlite) Close() {
 func (s *Sqlite) Insert(msg string) error {
 	b, err := json.Marshal(message{Msg: msg})
 	if err != nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"backup db insert error",
 			zap.String("service", serviceName),
 			zap.String("actor", s.name),
@@ -443,7 +483,7 @@ func (s *Sqlite) Insert(msg string) error {
 		},
 	)
 	if err != nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"backup db insert error",
 			zap.String("service", serviceName),
 			zap.String("actor", s.name),
@@ -457,6 +497,78 @@ func (s *Sqlite) Insert(msg string) error {
 	return nil
 }
 
+// InsertBatch inserts messages in a single transaction
+func (s *Sqlite) InsertBatch(msgs []string) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db transaction error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	stmt, err := tx.PrepareNamedContext(s.ctx, insertLog)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db prepare error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().Format(time.RFC3339)
+
+	for _, msg := range msgs {
+		b, err := json.Marshal(message{Msg: msg})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := stmt.ExecContext(s.ctx, log{Time: now, Msg: b}); err != nil {
+			l.GetLog().Error(
+				"backup db insert error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("error", err.Error()),
+			)
+
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		l.GetLog().Error(
+			"backup db commit error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	return nil
+}
+
 func (s *Sqlite) Start(startTime time.Time) error {
 	// use RFC3339 time format
 	_, err := s.db.NamedExecContext(
@@ -469,7 +581,7 @@ func (s *Sqlite) Start(startTime time.Time) error {
 		},
 	)
 	if err != nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"backup db insert start time error",
 			zap.String("service", serviceName),
 			zap.String("actor", s.name),
@@ -498,7 +610,7 @@ func (s *Sqlite) Stop(endTime time.Time) error {
 		},
 	)
 	if err != nil {
-		l.Logger.Error(
+		l.GetLog().Error(
 			"backup db insert stop time error",
 			zap.String("service", serviceName),
 			zap.String("actor", s.name),
@@ -511,6 +623,319 @@ func (s *Sqlite) Stop(endTime time.Time) error {
 	return nil
 }
 
+// SaveSnapshot stores actor's state snapshot
+//
+// codec: name of the codec serialized the state
+//
+// state: serialized state
+//
+// keep: <= 0: preserve all snapshots, > 0: preserve number of latest snapshots
+// across actor instances with the same name
+func (s *Sqlite) SaveSnapshot(codec string, state []byte, keep int) error {
+	if s.db == nil {
+		return ErrDbClosed
+	}
+
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db transaction error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	if err := s.saveSnapshot(tx, codec, state, keep); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		l.GetLog().Error(
+			"backup db commit error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	s.retainSiblingSnapshots(keep)
+
+	return nil
+}
+
+// saveSnapshot inserts snapshot within transaction tx
+func (s *Sqlite) saveSnapshot(tx *sqlx.Tx, codec string, state []byte, keep int) error {
+	sum := sha256.Sum256(state)
+
+	_, err := tx.NamedExecContext(
+		s.ctx,
+		insertSnapshot,
+		snapshot{
+			Time:     time.Now().Format(time.RFC3339Nano),
+			Codec:    codec,
+			Checksum: hex.EncodeToString(sum[:]),
+			State:    state,
+		},
+	)
+	if err != nil {
+		l.GetLog().Error(
+			"backup db insert snapshot error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	if keep > 0 {
+		if _, err := tx.ExecContext(s.ctx, retainSnapshot, keep); err != nil {
+			l.GetLog().Error(
+				"backup db snapshot retention error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.Int("keep", keep),
+				zap.String("error", err.Error()),
+			)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retainSiblingSnapshots removes snapshots left by previous actor instances
+// with the same name, thus keep latest snapshots are preserved across
+// instances
+//
+// snapshots of this instance are newer than snapshots of previous instances.
+// Snapshots of previous instances are read once, thus later calls open db
+// files of previous instances only to remove snapshots.
+func (s *Sqlite) retainSiblingSnapshots(keep int) {
+	if keep <= 0 {
+		return
+	}
+
+	defer s.siblingLock.Unlock()
+	s.siblingLock.Lock()
+
+	if !s.siblingLoaded {
+		s.siblingLoaded = true
+		s.siblingSnapshot = s.loadSiblingSnapshots()
+	}
+
+	if len(s.siblingSnapshot) == 0 {
+		return
+	}
+
+	var count int
+	if err := s.db.GetContext(s.ctx, &count, countSnapshot); err != nil {
+		return
+	}
+
+	keep -= count
+	if keep < 0 {
+		keep = 0
+	}
+
+	if len(s.siblingSnapshot) <= keep {
+		return
+	}
+
+	for _, fs := range s.siblingSnapshot[keep:] {
+		if err := s.deleteSnapshot(fs.file, fs.seq); err != nil {
+			l.GetLog().Error(
+				"snapshot retention error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("file", fs.file),
+				zap.Int("seq", fs.seq),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
+
+	s.siblingSnapshot = s.siblingSnapshot[:keep]
+}
+
+// loadSiblingSnapshots returns snapshots of previous actor instances with
+// the same name, newest first
+func (s *Sqlite) loadSiblingSnapshots() []fileSnapshot {
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return nil
+	}
+
+	var older []fileSnapshot
+
+	for _, dbFile := range dbFiles {
+		db, err := openReadOnly(dbFile)
+		if err != nil {
+			continue
+		}
+
+		var snapshots []snapshot
+		// db created before snapshot support has no snapshot table
+		err = db.SelectContext(s.ctx, &snapshots, selectSnapshotAt)
+		db.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, ss := range snapshots {
+			t, _ := time.Parse(time.RFC3339Nano, ss.Time)
+			older = append(older, fileSnapshot{dbFile, ss.Seq, t})
+		}
+	}
+
+	sort.Slice(older, func(i, j int) bool {
+		return older[i].time.After(older[j].time)
+	})
+
+	return older
+}
+
+// deleteSnapshot removes snapshot seq from db file
+func (s *Sqlite) deleteSnapshot(dbFile string, seq int) error {
+	db, err := sqlx.Open(
+		"sqlite3",
+		fmt.Sprintf(dbDSN, dbFile, cacheMode[PRIVATE], journalMode[DELETE]),
+	)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(s.ctx, deleteSnapshot, seq)
+	return err
+}
+
+// LoadLatestSnapshot returns the latest verified snapshot
+//
+// Snapshots left by previous actor instances with the same name are
+// considered as well, thus a restarted actor is able to recover its state.
+func (s *Sqlite) LoadLatestSnapshot() (string, []byte, error) {
+	if s.db == nil {
+		return "", nil, ErrDbClosed
+	}
+
+	latest, corrupt := s.latestSnapshot(s.db)
+
+	dbFiles, err := s.siblingDBs()
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, dbFile := range dbFiles {
+		db, err := openReadOnly(dbFile)
+		if err != nil {
+			l.GetLog().Error(
+				"snapshot db open error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("file", dbFile),
+				zap.String("error", err.Error()),
+			)
+
+			continue
+		}
+
+		ss, c := s.latestSnapshot(db)
+		db.Close()
+
+		corrupt = corrupt || c
+		if ss != nil && (latest == nil || ss.after(latest)) {
+			latest = ss
+		}
+	}
+
+	switch {
+	case latest != nil:
+		return latest.Codec, latest.State, nil
+	case corrupt:
+		return "", nil, ErrSnapshotChecksum
+	default:
+		return "", nil, ErrSnapshotNotFound
+	}
+}
+
+// after reports whether snapshot ss is taken after snapshot o
+func (ss *snapshot) after(o *snapshot) bool {
+	t1, _ := time.Parse(time.RFC3339Nano, ss.Time)
+	t2, _ := time.Parse(time.RFC3339Nano, o.Time)
+
+	return t1.After(t2)
+}
+
+// latestSnapshot returns the latest snapshot passed checksum verification
+//
+// returns true if any corrupted snapshot was found
+func (s *Sqlite) latestSnapshot(db *sqlx.DB) (*snapshot, bool) {
+	corrupt := false
+
+	rows, err := db.QueryxContext(s.ctx, selectSnapshot)
+	if err != nil {
+		// db created before snapshot support has no snapshot table
+		l.GetLog().Debug(
+			"snapshot query error",
+			zap.String("service", serviceName),
+			zap.String("actor", s.name),
+			zap.String("uuid", s.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return nil, corrupt
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ss snapshot
+		if err := rows.StructScan(&ss); err != nil {
+			l.GetLog().Error(
+				"snapshot StructScan error",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.String("error", err.Error()),
+			)
+
+			return nil, corrupt
+		}
+
+		sum := sha256.Sum256(ss.State)
+		if hex.EncodeToString(sum[:]) != ss.Checksum {
+			l.GetLog().Error(
+				"snapshot checksum mismatch",
+				zap.String("service", serviceName),
+				zap.String("actor", s.name),
+				zap.String("uuid", s.uuid),
+				zap.Int("seq", ss.Seq),
+				zap.String("time", ss.Time),
+			)
+
+			corrupt = true
+			continue
+		}
+
+		return &ss, corrupt
+	}
+
+	return nil, corrupt
+}
+
 // func main_test() {
 // fmt.Println("starts")
 // ctx, cancel := context.WithCancel(context.Background())
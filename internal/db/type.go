@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -32,11 +33,97 @@ type Sqlite struct {
 	cache   int
 	rotate  int
 	db      *sqlx.DB
+
+	// snapshots of previous actor instances, newest first, loaded by the
+	// first snapshot retention
+	siblingLock     sync.Mutex
+	siblingLoaded   bool
+	siblingSnapshot []fileSnapshot
+}
+
+// fileSnapshot is a snapshot stored in db file
+type fileSnapshot struct {
+	file string
+	seq  int
+	time time.Time
+}
+
+// Record is a backed up message
+type Record struct {
+	Name    string    // actor name
+	UUID    string    // actor uuid
+	Seq     int64     // message sequence, ordered across rotate db
+	Time    time.Time // message backup time
+	Message string    // backed up message
+	File    string    // db file stores the message
+}
+
+// Cursor is the position of Follow per actor instance
+type Cursor struct {
+	seq  map[string]int64 // uuid -> last read sequence
+	done map[string]bool  // rotate db read completely
+}
+
+// NewCursor returns Cursor positioned before the first message
+func NewCursor() *Cursor {
+	return &Cursor{
+		seq:  make(map[string]int64),
+		done: make(map[string]bool),
+	}
+}
+
+// Filter selects backed up messages
+type Filter struct {
+	From    time.Time // zero: unbounded
+	To      time.Time // zero: unbounded
+	FromSeq int64     // 0: unbounded
+	ToSeq   int64     // 0: unbounded
+}
+
+// ActorInfo is the actor instance stored in backup db
+type ActorInfo struct {
+	Name      string
+	UUID      string
+	StartTime time.Time // zero: unknown
+	EndTime   time.Time // zero: actor still running or not stopped cleanly
+	File      string    // live db file
+	Rotated   []string  // rotate db files, ordered by rotation
+}
+
+// Retention selects backup db files to be removed, zero value removes nothing
+type Retention struct {
+	// rotate db older than MaxAge, and db of actors ended longer than MaxAge
+	// if RemoveEnded, are removed, 0: unlimited
+	MaxAge time.Duration
+	// live db of actors ended longer than MaxAge, and of actors not ended nor
+	// running not written longer than MaxAge, are removed, except db with
+	// pending mailbox or outbox messages
+	RemoveEnded bool
+	// uuids of running actors, nil: actor not ended is running until its db
+	// is not written longer than MaxAge
+	Running map[string]bool
+	// oldest rotate db are removed while total db size exceeds, 0: unlimited
+	MaxTotalBytes int64
+	// rotate db preserved per actor instance, oldest are removed, 0: unlimited
+	MaxRotated int
+}
+
+// Mail is a message stored in durable mailbox
+type Mail struct {
+	ID       string    // message id
+	Time     time.Time // enqueue time
+	Codec    string    // name of the codec serialized the payload
+	Payload  []byte    // serialized message
+	Attempts int       // delivery attempts
+	Reason   string    // dead letter reason
 }
 
-type DB interface {
-	Close()
-	Insert(msg string) error
-	Start(startTime time.Time) error
-	Stop(endTime time.Time) error
+// Outbox is an outgoing message recorded along with actor's state change
+type Outbox struct {
+	ID       string    // message id
+	Time     time.Time // record time
+	Target   string    // receiving actor name
+	Codec    string    // name of the codec serialized the payload
+	Payload  []byte    // serialized message
+	Attempts int       // failed delivery attempts
 }
@@ -0,0 +1,4 @@
+// Package filelog implements append-only, segmented file log
+//
+// filelog is the pure-Go backup storage, it does not require cgo.
+package filelog
@@ -0,0 +1,440 @@
+package filelog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// record header: 4 bytes payload length, 4 bytes payload crc32c
+const headerSize = 8
+
+const (
+	// default segment size in bytes
+	defaultSegmentBytes = 64 << 20
+	// upper bound of a record payload, guards against corrupted length
+	maxRecordBytes = 1 << 30
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrClosed log is closed
+	ErrClosed = errors.New("file log is closed")
+	// ErrCorrupt record fails length or checksum verification
+	ErrCorrupt = errors.New("file log record corrupted")
+	// ErrTooLarge record payload exceeds maxRecordBytes
+	ErrTooLarge = errors.New("file log record too large")
+)
+
+type (
+	// Log is an append-only, segmented file log
+	//
+	// Records are length-prefixed and crc32c checked. Segment files are
+	// named <prefix>_<N>.seg, the last segment is the active one.
+	Log struct {
+		lock       sync.Mutex
+		dir        string
+		prefix     string
+		maxBytes   int64 // rotate segment once size exceeds
+		maxRecords int   // rotate segment once records exceed, 0: unlimited
+		seq        int   // active segment sequence
+		file       *os.File
+		writer     *bufio.Writer
+		size       int64 // active segment size
+		records    int   // active segment records
+	}
+
+	// Segment is a segment file with its sequence
+	Segment struct {
+		Seq  int
+		File string
+	}
+)
+
+// Open opens or creates the log under dir
+//
+// Torn or corrupted records at the tail of the active segment, left by a
+// crash in the middle of a write, are truncated.
+//
+// dir: directory stores segment files
+//
+// prefix: segment file name prefix
+//
+// maxBytes: <= 0: default 64MiB, > 0: rotate segment once size exceeds
+//
+// maxRecords: 0: unlimited, > 0: rotate segment once records exceed
+func Open(dir, prefix string, maxBytes int64, maxRecords int) (*Log, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSegmentBytes
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	lg := &Log{
+		dir:        dir,
+		prefix:     prefix,
+		maxBytes:   maxBytes,
+		maxRecords: maxRecords,
+	}
+
+	segs, err := Segments(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(segs) == 0 {
+		return lg, lg.openSegment(1)
+	}
+
+	last := segs[len(segs)-1]
+
+	size, records, err := repair(last.File)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lg.openSegment(last.Seq); err != nil {
+		return nil, err
+	}
+
+	lg.size, lg.records = size, records
+
+	return lg, nil
+}
+
+// Prefixes returns prefixes of logs under dir in order
+func Prefixes(dir string) ([]string, error) {
+	re := regexp.MustCompile(`^(.+)_\d+\.seg$`)
+
+	m, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var prefixes []string
+
+	for _, file := range m {
+		if match := re.FindStringSubmatch(filepath.Base(file)); match != nil && !seen[match[1]] {
+			seen[match[1]] = true
+			prefixes = append(prefixes, match[1])
+		}
+	}
+
+	sort.Strings(prefixes)
+
+	return prefixes, nil
+}
+
+// Repair truncates torn or corrupted records at the tail of the last
+// segment of a log, left by a crash of the writer
+//
+// the log must not be opened for writing.
+func Repair(dir, prefix string) error {
+	segs, err := Segments(dir, prefix)
+	if err != nil || len(segs) == 0 {
+		return err
+	}
+
+	_, _, err = repair(segs[len(segs)-1].File)
+
+	return err
+}
+
+// Segments returns segment files of the log ordered by sequence
+func Segments(dir, prefix string) ([]Segment, error) {
+	re := regexp.MustCompile(
+		fmt.Sprintf(`^%s_(\d+)\.seg$`, regexp.QuoteMeta(prefix)))
+
+	m, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []Segment
+
+	for _, file := range m {
+		if match := re.FindStringSubmatch(filepath.Base(file)); match != nil {
+			seq, _ := strconv.Atoi(match[1])
+			segs = append(segs, Segment{seq, file})
+		}
+	}
+
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].Seq < segs[j].Seq
+	})
+
+	return segs, nil
+}
+
+// repair scans segment file and truncates it after the last valid record
+//
+// returns size and number of valid records
+func repair(file string) (int64, int, error) {
+	f, err := os.OpenFile(file, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var offset int64
+	records := 0
+	r := bufio.NewReader(f)
+
+	for {
+		payload, err := readRecord(r)
+		if err == io.EOF {
+			return offset, records, nil
+		}
+
+		if err != nil {
+			l.GetLog().Error(
+				"file log tail truncated",
+				zap.String("service", serviceName),
+				zap.String("file", file),
+				zap.Int64("offset", offset),
+				zap.String("error", err.Error()),
+			)
+
+			if err := f.Truncate(offset); err != nil {
+				return 0, 0, err
+			}
+
+			return offset, records, f.Sync()
+		}
+
+		offset += int64(headerSize + len(payload))
+		records++
+	}
+}
+
+// readRecord reads a record
+//
+// returns io.EOF at clean end of file, ErrCorrupt on torn or corrupted record
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [headerSize]byte
+
+	if n, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+
+		return nil, ErrCorrupt
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > maxRecordBytes {
+		return nil, ErrCorrupt
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupt
+	}
+
+	return payload, nil
+}
+
+func (lg *Log) segmentFile(seq int) string {
+	return filepath.Join(lg.dir, fmt.Sprintf("%s_%d.seg", lg.prefix, seq))
+}
+
+func (lg *Log) openSegment(seq int) error {
+	f, err := os.OpenFile(
+		lg.segmentFile(seq),
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+		0600,
+	)
+	if err != nil {
+		return err
+	}
+
+	lg.seq = seq
+	lg.file = f
+	lg.writer = bufio.NewWriter(f)
+	lg.size = 0
+	lg.records = 0
+
+	return nil
+}
+
+// rotate seals the active segment and opens the next one
+func (lg *Log) rotate() error {
+	if err := lg.writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := lg.file.Close(); err != nil {
+		return err
+	}
+
+	return lg.openSegment(lg.seq + 1)
+}
+
+// Append appends record payloads, buffered until Flush
+func (lg *Log) Append(payloads ...[]byte) error {
+	defer lg.lock.Unlock()
+	lg.lock.Lock()
+
+	if lg.file == nil {
+		return ErrClosed
+	}
+
+	var header [headerSize]byte
+
+	for _, payload := range payloads {
+		if len(payload) > maxRecordBytes {
+			return ErrTooLarge
+		}
+
+		if lg.size >= lg.maxBytes ||
+			(lg.maxRecords > 0 && lg.records >= lg.maxRecords) {
+			if err := lg.rotate(); err != nil {
+				return err
+			}
+		}
+
+		binary.BigEndian.PutUint32(header[:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(
+			header[4:], crc32.Checksum(payload, crcTable))
+
+		if _, err := lg.writer.Write(header[:]); err != nil {
+			return err
+		}
+
+		if _, err := lg.writer.Write(payload); err != nil {
+			return err
+		}
+
+		lg.size += int64(headerSize + len(payload))
+		lg.records++
+	}
+
+	return nil
+}
+
+// Flush writes buffered records into the active segment
+func (lg *Log) Flush() error {
+	defer lg.lock.Unlock()
+	lg.lock.Lock()
+
+	if lg.file == nil {
+		return ErrClosed
+	}
+
+	return lg.writer.Flush()
+}
+
+// Sync flushes buffered records and commits the active segment to disk
+func (lg *Log) Sync() error {
+	defer lg.lock.Unlock()
+	lg.lock.Lock()
+
+	if lg.file == nil {
+		return ErrClosed
+	}
+
+	if err := lg.writer.Flush(); err != nil {
+		return err
+	}
+
+	return lg.file.Sync()
+}
+
+// Close flushes buffered records and closes the log
+func (lg *Log) Close() error {
+	defer lg.lock.Unlock()
+	lg.lock.Lock()
+
+	if lg.file == nil {
+		return nil
+	}
+
+	err := lg.writer.Flush()
+	if cerr := lg.file.Close(); err == nil {
+		err = cerr
+	}
+
+	lg.file = nil
+
+	return err
+}
+
+// Read iterates record payloads of the log in order
+//
+// returns ErrCorrupt at the first corrupted record.
+// iteration stops and returns the error if fn returns error
+func Read(dir, prefix string, fn func(payload []byte) error) error {
+	segs, err := Segments(dir, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range segs {
+		if err := ReadSegment(seg.File, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadSegment iterates record payloads of segment file in order
+//
+// returns ErrCorrupt at the first corrupted record.
+// iteration stops and returns the error if fn returns error
+func ReadSegment(file string, fn func(payload []byte) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var offset int64
+	r := bufio.NewReader(f)
+
+	for {
+		payload, err := readRecord(r)
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil
+		default:
+			l.GetLog().Error(
+				"file log record corrupted",
+				zap.String("service", serviceName),
+				zap.String("file", file),
+				zap.Int64("offset", offset),
+				zap.String("error", err.Error()),
+			)
+
+			return fmt.Errorf("%s offset %d: %w", file, offset, err)
+		}
+
+		if err := fn(payload); err != nil {
+			return err
+		}
+
+		offset += int64(headerSize + len(payload))
+	}
+}
@@ -0,0 +1,166 @@
+package filelog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func readAll(t *testing.T, dir, prefix string) []string {
+	var records []string
+
+	err := Read(dir, prefix, func(payload []byte) error {
+		records = append(records, string(payload))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return records
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lg, err := Open(dir, "rotate", 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := 0; idx < 10; idx++ {
+		if err := lg.Append([]byte(fmt.Sprintf("record %d", idx))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lg.Close()
+
+	segs, err := Segments(dir, "rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(segs) != 4 {
+		t.Errorf("expecting: 4 segments, receiving: %d", len(segs))
+	}
+
+	records := readAll(t, dir, "rotate")
+	if len(records) != 10 || records[9] != "record 9" {
+		t.Errorf("expecting: 10 records in order, receiving: %v", records)
+	}
+
+	// size based rotation
+	lg, err = Open(dir, "size", 2*(headerSize+8), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := 0; idx < 4; idx++ {
+		lg.Append([]byte(fmt.Sprintf("record %d", idx)))
+	}
+	lg.Close()
+
+	if segs, _ := Segments(dir, "size"); len(segs) != 2 {
+		t.Errorf("expecting: 2 segments, receiving: %d", len(segs))
+	}
+}
+
+func TestRecoverTornTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lg, err := Open(dir, "torn", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lg.Append([]byte("record 0"), []byte("record 1"))
+	lg.Close()
+
+	segs, _ := Segments(dir, "torn")
+	fi, _ := os.Stat(segs[0].File)
+
+	// simulate crash in the middle of writing a record
+	f, _ := os.OpenFile(segs[0].File, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 0, 42, 1, 2, 3, 4, 'p', 'a', 'r'})
+	f.Close()
+
+	lg, err = Open(dir, "torn", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fi2, _ := os.Stat(segs[0].File); fi2.Size() != fi.Size() {
+		t.Errorf("expecting size: %d, receiving: %d", fi.Size(), fi2.Size())
+	}
+
+	lg.Append([]byte("record 2"))
+	lg.Close()
+
+	records := readAll(t, dir, "torn")
+	if len(records) != 3 || records[2] != "record 2" {
+		t.Errorf("expecting: 3 records in order, receiving: %v", records)
+	}
+
+	// corrupted checksum is truncated as well
+	f, _ = os.OpenFile(segs[0].File, os.O_RDWR, 0600)
+	f.WriteAt([]byte{'X'}, fi.Size()+headerSize)
+	f.Close()
+
+	lg, err = Open(dir, "torn", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Close()
+
+	if records := readAll(t, dir, "torn"); len(records) != 2 {
+		t.Errorf("expecting: 2 records, receiving: %v", records)
+	}
+}
+
+func TestReadCorrupt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lg, err := Open(dir, "crashed", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lg.Append([]byte("record 0"))
+	lg.Close()
+
+	// crashed writer leaves a torn record
+	segs, _ := Segments(dir, "crashed")
+	f, _ := os.OpenFile(segs[0].File, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 0, 42, 1, 2})
+	f.Close()
+
+	if err := Read(dir, "crashed", func([]byte) error { return nil }); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expecting: %v, receiving: %v", ErrCorrupt, err)
+	}
+
+	if prefixes, _ := Prefixes(dir); len(prefixes) != 1 || prefixes[0] != "crashed" {
+		t.Fatalf("expecting: [crashed], receiving: %v", prefixes)
+	}
+
+	if err := Repair(dir, "crashed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := readAll(t, dir, "crashed"); len(records) != 1 {
+		t.Errorf("expecting: 1 record, receiving: %v", records)
+	}
+}
@@ -0,0 +1,3 @@
+package filelog
+
+const serviceName = "filelog"
@@ -1,78 +1,89 @@
 package logger
 
 import (
-	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-var logger serviceLogger
-var origLogger serviceLogger
-
-func init() {
-	initLogger()
-}
+var (
+	lock sync.RWMutex
+	// default log level set to 'info'
+	level         = zap.NewAtomicLevelAt(zap.InfoLevel)
+	defaultLogger = newDefaultLogger(level)
+	// default logger ignores service log level, used by per-actor log level
+	rawLogger = newDefaultLogger(zap.LevelEnablerFunc(
+		func(zapcore.Level) bool { return true }))
+	logger ServiceLogger = defaultLogger
+)
 
 // LogSync sync logger output
 func LogSync() {
 	// ignore logger Sync error
-	logger.Sync()
+	if s, ok := GetLog().(syncer); ok {
+		s.Sync()
+	}
 }
 
-// SetLogger sets caller provided zap logger
+// SetServiceLogger sets caller provided logger
 //
-// reset to service's default logger by passing in nil pointer
-func SetLogger(l *zap.Logger) {
-	if l != nil {
-		logger.Logger = l
-		logger.provided = true
-		return
+// reset to service's default logger by passing in nil
+func SetServiceLogger(l ServiceLogger) {
+	defer lock.Unlock()
+	lock.Lock()
+
+	if l == nil {
+		l = defaultLogger
 	}
 
-	logger = origLogger
+	logger = l
 }
 
-// SetLogLevel sets the service log level
+// SetLogLevel sets the log level of service's default logger
 //
-// noop if caller provides it's own zap logger
-func SetLogLevel(level zapcore.Level) {
-	if logger.provided {
-		return
-	}
-
-	logger.config.Level.SetLevel(level)
+// noop if caller provides it's own logger
+func SetLogLevel(l zapcore.Level) {
+	level.SetLevel(l)
 }
 
-func initLogger() {
-	// default log level set to 'info'
-	atom := zap.NewAtomicLevelAt(zap.InfoLevel)
+// newDefaultLogger builds JSON logger writes to stderr
+//
+// built from zapcore directly, thus never fails
+func newDefaultLogger(enabler zapcore.LevelEnabler) *zap.Logger {
+	core := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		enabler,
+	)
 
-	config := zap.Config{
-		Level:       atom,
-		Development: false,
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
-		Encoding:         "json", // console, json, toml
-		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
-	}
+	return zap.New(
+		zapcore.NewSampler(core, time.Second, 100, 100),
+		zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+	)
+}
 
-	mylogger, err := config.Build()
-	if err != nil {
-		fmt.Printf("Initialize zap logger error: %v\n", err)
-		os.Exit(1)
-	}
+// GetLog gets the current logger
+func GetLog() ServiceLogger {
+	defer lock.RUnlock()
+	lock.RLock()
 
-	logger = serviceLogger{mylogger, &config, false}
-	origLogger = logger
+	return logger
 }
 
-// GetLog gets the current logger
-func GetLog() serviceLogger {
+// GetRawLog gets the current logger, ignores service log level if it's the
+// default logger
+//
+// caller filters log level by itself
+func GetRawLog() ServiceLogger {
+	defer lock.RUnlock()
+	lock.RLock()
+
+	if logger == ServiceLogger(defaultLogger) {
+		return rawLogger
+	}
+
 	return logger
 }
@@ -4,8 +4,16 @@ import (
 	"go.uber.org/zap"
 )
 
-type serviceLogger struct {
-	*zap.Logger
-	config   *zap.Config
-	provided bool
+// ServiceLogger is the structured logger used by the service
+//
+// *zap.Logger implements ServiceLogger.
+type ServiceLogger interface {
+	Debug(msg string, fields ...zap.Field)
+	Info(msg string, fields ...zap.Field)
+	Warn(msg string, fields ...zap.Field)
+	Error(msg string, fields ...zap.Field)
+}
+
+type syncer interface {
+	Sync() error
 }
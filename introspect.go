@@ -0,0 +1,217 @@
+package actor
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// ActorStats is the runtime state of a registered actor
+	ActorStats struct {
+		Name            string        `json:"name"`
+		UUID            string        `json:"uuid"`
+		Parent          string        `json:"parent,omitempty"`      // parent actor name
+		ParentUUID      string        `json:"parent_uuid,omitempty"` // parent actor uuid
+		StartTime       time.Time     `json:"start_time"`            // zero: not started
+		Idle            time.Duration `json:"idle"`
+		MailboxDepth    int           `json:"mailbox_depth"`    // messages waiting in mailbox
+		MailboxCapacity int           `json:"mailbox_capacity"` // mailbox buffer size
+		Backup          BackupStatus  `json:"backup"`
+	}
+
+	// BackupStatus reports backup features enabled for actor
+	BackupStatus struct {
+		Enabled   bool `json:"enabled"`
+		Batched   bool `json:"batched"`   // WithBatchBackup
+		Encoded   bool `json:"encoded"`   // WithBackupEncoding
+		Snapshots bool `json:"snapshots"` // BackupStore supports snapshots
+		Durable   bool `json:"durable"`   // WithDurableMailbox
+		Dedup     bool `json:"dedup"`     // WithDedup
+		Outbox    bool `json:"outbox"`    // WithOutbox
+	}
+
+	// SupervisorNode is an actor within the supervisor tree
+	SupervisorNode struct {
+		Name     string            `json:"name"`
+		UUID     string            `json:"uuid"`
+		Children []*SupervisorNode `json:"children,omitempty"`
+	}
+
+	// SystemSnapshot is the runtime state of registered actors
+	SystemSnapshot struct {
+		Time   time.Time         `json:"time"`
+		Actors []ActorStats      `json:"actors"` // ordered by name
+		Tree   []*SupervisorNode `json:"tree"`   // actors without registered parent
+	}
+
+	debugHandler struct{}
+)
+
+// List returns names of registered actors in order
+func List() []string {
+	defer regActor.rwLock.RUnlock()
+	regActor.rwLock.RLock()
+
+	names := make([]string, 0, len(regActor.nameUUID))
+	for name := range regActor.nameUUID {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Stats returns runtime state of registered actor by name
+func Stats(name string) (ActorStats, error) {
+	defer regActor.rwLock.RUnlock()
+	regActor.rwLock.RLock()
+
+	if actor, ok := regActor.uuidActor[regActor.nameUUID[name]]; ok {
+		return actor.stats(), nil
+	}
+
+	return ActorStats{}, ErrRetrieveActor
+}
+
+// Snapshot returns runtime state of registered actors along with the
+// supervisor tree set by WithParent
+func Snapshot() SystemSnapshot {
+	regActor.rwLock.RLock()
+	actors := make([]ActorStats, 0, len(regActor.uuidActor))
+	for _, actor := range regActor.uuidActor {
+		actors = append(actors, actor.stats())
+	}
+	regActor.rwLock.RUnlock()
+
+	sort.Slice(actors, func(i, j int) bool {
+		return actors[i].Name < actors[j].Name
+	})
+
+	nodes := make(map[string]*SupervisorNode, len(actors))
+	for _, s := range actors {
+		nodes[s.UUID] = &SupervisorNode{Name: s.Name, UUID: s.UUID}
+	}
+
+	tree := make([]*SupervisorNode, 0)
+	for _, s := range actors {
+		node := nodes[s.UUID]
+
+		if parent, ok := nodes[s.ParentUUID]; ok && s.ParentUUID != s.UUID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree = append(tree, node)
+		}
+	}
+
+	return SystemSnapshot{
+		Time:   time.Now(),
+		Actors: actors,
+		Tree:   tree,
+	}
+}
+
+func (actor *localActor) stats() ActorStats {
+	actor.stampLock.RLock()
+	start := actor.startTime
+	actor.stampLock.RUnlock()
+
+	s := ActorStats{
+		Name:            actor.name,
+		UUID:            actor.uuid,
+		StartTime:       start,
+		Idle:            actor.Idle(),
+		MailboxDepth:    actor.mailboxLen(),
+		MailboxCapacity: actor.mailboxCap(),
+		Backup: BackupStatus{
+			Enabled: actor.store != nil,
+			Batched: actor.batch != nil,
+			Encoded: actor.encoding.Compress || actor.encoding.Keys != nil,
+			Durable: actor.mailbox != nil,
+			Dedup:   actor.dedup != nil,
+			Outbox:  actor.relay != nil,
+		},
+	}
+
+	if actor.parent != nil {
+		s.Parent, s.ParentUUID = actor.parent.Name(), actor.parent.UUID()
+	}
+
+	if _, ok := actor.store.(SnapshotStore); ok {
+		s.Backup.Snapshots = true
+	}
+
+	return s
+}
+
+// DebugHandler returns http.Handler serves Snapshot, mountable on admin
+// server, e.g. mux.Handle("/debug/actors", actor.DebugHandler())
+//
+// Snapshot is served as HTML, or JSON if requested with ?format=json or
+// Accept: application/json. ?name=<actor> serves Stats of the actor, 404 if
+// not registered.
+func DebugHandler() http.Handler {
+	return debugHandler{}
+}
+
+func (debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	asJSON := r.URL.Query().Get("format") == "json" ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	var view interface{}
+
+	if name := r.URL.Query().Get("name"); name != "" {
+		s, err := Stats(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		view = SystemSnapshot{Time: time.Now(), Actors: []ActorStats{s}}
+		if asJSON {
+			view = s
+		}
+	} else {
+		view = Snapshot()
+	}
+
+	if asJSON {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(view)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugPage.Execute(w, view)
+}
+
+var debugPage = template.Must(template.New("actors").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>actors</title></head>
+<body>
+<h1>actors</h1>
+<p>{{.Time.Format "2006-01-02T15:04:05.000Z07:00"}}, {{len .Actors}} registered</p>
+<table border="1" cellpadding="4">
+<tr><th>name</th><th>uuid</th><th>parent</th><th>start time</th><th>idle</th><th>mailbox</th><th>backup</th></tr>
+{{range .Actors}}<tr>
+<td><a href="?name={{.Name}}">{{.Name}}</a></td>
+<td>{{.UUID}}</td>
+<td>{{.Parent}}</td>
+<td>{{if not .StartTime.IsZero}}{{.StartTime.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</td>
+<td>{{.Idle}}</td>
+<td>{{.MailboxDepth}}/{{.MailboxCapacity}}</td>
+<td>{{with .Backup}}{{if .Enabled}}enabled{{if .Batched}} batched{{end}}{{if .Encoded}} encoded{{end}}{{if .Snapshots}} snapshots{{end}}{{if .Durable}} durable{{end}}{{if .Dedup}} dedup{{end}}{{if .Outbox}} outbox{{end}}{{else}}disabled{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{if .Tree}}<h2>supervisor tree</h2>
+{{template "tree" .Tree}}{{end}}
+</body>
+</html>
+{{define "tree"}}<ul>{{range .}}<li>{{.Name}} <small>{{.UUID}}</small>{{if .Children}}{{template "tree" .Children}}{{end}}</li>{{end}}</ul>{{end}}`))
@@ -0,0 +1,159 @@
+package actor_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vsdmars/actor"
+)
+
+// createFamily creates parent actor with two children
+func createFamily(t *testing.T, ctx context.Context) []actor.Actor {
+	cases := createTestCase(3, 2, -1)
+
+	handler := func(act actor.Actor) {
+		<-act.Done()
+	}
+
+	parent, err := actor.NewActor(
+		ctx, cases[0].name, cases[0].buffer, handler, cases[0].backup)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	family := []actor.Actor{parent}
+
+	for _, tc := range cases[1:] {
+		child, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			handler,
+			tc.backup,
+			actor.WithParent(parent),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		family = append(family, child)
+	}
+
+	return family
+}
+
+func TestIntrospection(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	family := createFamily(t, ctx)
+
+	if err := family[1].Send("waiting"); err != nil {
+		t.Fatal(err)
+	}
+
+	names := make(map[string]bool)
+	for _, name := range actor.List() {
+		names[name] = true
+	}
+
+	for _, act := range family {
+		if !names[act.Name()] {
+			t.Fatalf("expecting: %s listed", act.Name())
+		}
+	}
+
+	s, err := actor.Stats(family[1].Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.UUID != family[1].UUID() || s.Parent != family[0].Name() {
+		t.Fatalf("expecting: child of %s, receiving: %+v", family[0].Name(), s)
+	}
+
+	if s.MailboxDepth != 1 || s.MailboxCapacity != 2 || s.Backup.Enabled {
+		t.Fatalf("expecting: mailbox 1/2 without backup, receiving: %+v", s)
+	}
+
+	if _, err := actor.Stats("not registered"); err != actor.ErrRetrieveActor {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrRetrieveActor, err)
+	}
+
+	var root *actor.SupervisorNode
+	for _, node := range actor.Snapshot().Tree {
+		if node.UUID == family[0].UUID() {
+			root = node
+		}
+	}
+
+	if root == nil || len(root.Children) != 2 {
+		t.Fatalf("expecting: %s supervises 2 actors, receiving: %+v",
+			family[0].Name(), root)
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	family := createFamily(t, ctx)
+	handler := actor.DebugHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json", nil))
+
+	var snap actor.SystemSnapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snap); err != nil {
+		t.Fatal(err)
+	}
+
+	found := 0
+	for _, s := range snap.Actors {
+		for _, act := range family {
+			if s.UUID == act.UUID() {
+				found++
+			}
+		}
+	}
+
+	if found != len(family) {
+		t.Fatalf("expecting: %d actors, receiving: %d", len(family), found)
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/?name="+family[2].Name(), nil)
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(rec, req)
+
+	var s actor.ActorStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.UUID != family[2].UUID() || s.ParentUUID != family[0].UUID() {
+		t.Fatalf("expecting: %s, receiving: %+v", family[2].UUID(), s)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expecting: text/html, receiving: %s", ct)
+	}
+
+	if body := rec.Body.String(); !strings.Contains(body, family[1].UUID()) ||
+		!strings.Contains(body, "supervisor tree") {
+		t.Fatalf("expecting: actors and supervisor tree in\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/?name=not+registered", nil))
+
+	if rec.Code != 404 {
+		t.Fatalf("expecting: 404, receiving: %d", rec.Code)
+	}
+}
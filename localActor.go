@@ -5,9 +5,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	idb "github.com/vsdmars/actor/internal/db"
-	. "github.com/vsdmars/actor/internal/logger"
-
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
@@ -23,50 +20,181 @@ import (
 // callbackFn: actor handler
 //
 // b: < 0: disable backup, == 0: backup without rotation, > 0: backup with rotation rows
+//
+// opts: actor options
 func NewActor(
 	ctx context.Context, // caller's context, able to cancel created actor.
 	name string, // actor's name
 	buffer int, // actor's channel buffer
 	callbackFn HandleType, // actor's handler
 	b int, // backup actor's receiving message
+	opts ...Option, // actor options
 ) (Actor, error) {
+	la, recovered, err := newActor(ctx, name, buffer, b, newOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	actor := Actor(la)
+
+	go func() {
+		defer func() {
+			regActor.deregister(actor)
+			actor.endStamp()
+			actor.close()
+
+			if m := getMetrics(); m != nil {
+				la.recordReceived(m)
+			}
+
+			if r := recover(); r != nil {
+				la.reportPanic(r)
+			}
+		}()
+
+		actor.startStamp()
+
+		// sender of messages sent by handler
+		slot := trackHandler()
+		slot.set(la.name)
+		defer slot.release()
 
+		go actor.increaseIdle()
+
+		if la.relay != nil {
+			go la.relay.run()
+		}
+
+		if len(recovered) > 0 {
+			go la.redeliver(recovered)
+		}
+
+		// block call
+		// return closes the channel, actor dies
+		callbackFn(actor)
+	}()
+
+	return actor, nil
+}
+
+// newActor creates and registers local actor, returns messages recovered
+// from durable mailbox of previous instances
+func newActor(
+	ctx context.Context,
+	name string,
+	buffer int,
+	b int,
+	o options,
+) (*localActor, []MailboxEntry, error) {
 	if buffer < 0 {
-		return nil, ErrChannelBuffer
+		return nil, nil, ErrChannelBuffer
 	}
 
-	var db idb.DB
 	uuidVal := uuid.New().String()
+	log := newActorLogger(name, o.logger)
+
+	var store BackupStore
 
 	if b >= 0 {
-		// using sqlite for local backup
-		s, err := idb.NewSqlite(
-			ctx,
-			name,
-			uuidVal,
-			idb.DELETE, // sqlite journal mode
-			idb.SHARED, // sqlite cache mode
-			b,          // rotate records
-			30,         // rotate period/seconds
-		)
+		f := o.backup
+		if f == nil {
+			f = getBackup()
+		}
+
+		s, err := f(ctx, name, uuidVal, b)
 		if err != nil {
-			GetLog().Error(
-				"backup db creation error",
+			log.Error(
+				"backup store creation error",
 				zap.String("service", serviceName),
 				zap.String("actor", name),
 				zap.String("error", err.Error()),
 			)
 
-			return nil, err
+			return nil, nil, err
 		}
 
-		db = s
+		store = s
+	}
+
+	var batch *batchWriter
+	if store != nil && o.batched {
+		batch = newBatchWriter(
+			name, uuidVal, store, o.batchSize, o.batchLatency, log)
 	}
 
-	// create Actor's context
-	ctx, cancel := context.WithCancel(ctx)
+	// release closes backup store on creation failure
+	release := func() {
+		if batch != nil {
+			batch.Close()
+		}
+
+		if store != nil {
+			store.Close()
+		}
+	}
+
+	var mailbox MailboxStore
+	if o.durable {
+		if store == nil {
+			return nil, nil, ErrBackupDisabled
+		}
+
+		ms, ok := store.(MailboxStore)
+		if !ok {
+			release()
+
+			return nil, nil, ErrMailboxUnsupported
+		}
+
+		mailbox = ms
+	}
+
+	var ob OutboxStore
+	if o.outbox != nil {
+		if store == nil {
+			return nil, nil, ErrBackupDisabled
+		}
+
+		s, ok := store.(OutboxStore)
+		if !ok {
+			release()
+
+			return nil, nil, ErrOutboxUnsupported
+		}
+
+		ob = s
+	}
+
+	var dd *dedup
+	if o.dedup != nil {
+		var ds DedupStore
+
+		if o.dedup.Persist {
+			s, ok := store.(DedupStore)
+			if !ok {
+				release()
+
+				return nil, nil, ErrDedupUnsupported
+			}
+
+			ds = s
+		}
+
+		dd = newDedup(*o.dedup, ds)
+	}
+
+	// create Actor's context, carries actor as sender of messages sent with
+	// it by handler
+	ctx, cancel := context.WithCancel(withActorSender(ctx, name))
 	// create Actor's message channel
-	pipe := make(chan interface{}, buffer)
+	var pipe chan interface{}
+	var ring *RingMailbox[interface{}]
+
+	if o.ring {
+		ring = NewRingMailbox[interface{}](buffer)
+	} else {
+		pipe = make(chan interface{}, buffer)
+	}
 
 	// escape localActor object store ptr to localActor instance into Actor interface
 	actor := Actor(
@@ -75,14 +203,25 @@ func NewActor(
 			uuid:         uuidVal,
 			actorContext: actorContext{ctx, cancel},
 			channels:     channels{pipe, pipe},
-			backup:       backup{db},
+			backup:       backup{store, batch, mailbox},
+			options:      o,
+			actorLog:     log,
+			dedup:        dd,
+			ring:         ring,
 		},
 	)
 
+	if ob != nil {
+		la := actor.(*localActor)
+		la.relay = newRelay(la, ob, *o.outbox)
+	}
+
 	if err := regActor.register(actor); err != nil {
 		actor.close() // clean up actor
 
-		GetLog().Debug(
+		release()
+
+		log.Debug(
 			"clean up duplicated actor",
 			zap.String("service", serviceName),
 			zap.String("actor", actor.Name()),
@@ -90,45 +229,88 @@ func NewActor(
 			zap.String("error", err.Error()),
 		)
 
-		return nil, err
+		return nil, nil, err
 	}
 
-	go func() {
-		defer func() {
-			regActor.deregister(actor)
-			actor.endStamp()
-			actor.close()
-
-			if r := recover(); r != nil {
-				GetLog().Error(
-					"actor handler panic",
-					zap.String("service", serviceName),
-					zap.String("actor", actor.Name()),
-					zap.String("uuid", actor.UUID()),
-					zap.Any("panic", r),
-				)
-			}
-		}()
+	// ids seen by previous instances are loaded before delivering messages
+	if dd != nil && dd.store != nil {
+		if err := dd.load(); err != nil {
+			log.Error(
+				"dedup load error",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.Name()),
+				zap.String("uuid", actor.UUID()),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
 
-		actor.startStamp()
+	// recovered after registration, thus no live instance owns the messages
+	var recovered []MailboxEntry
+	if mailbox != nil {
+		entries, err := mailbox.Recover()
+		if err != nil {
+			log.Error(
+				"mailbox recover error",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.Name()),
+				zap.String("uuid", actor.UUID()),
+				zap.String("error", err.Error()),
+			)
+		}
 
-		go actor.increaseIdle()
+		recovered = entries
+	}
 
-		// block call
-		// return closes the channel, actor dies
-		callbackFn(actor)
-	}()
+	// claimed once before relay starts, flush reads this instance's db only
+	if ob != nil {
+		if err := ob.ClaimOutbox(); err != nil {
+			log.Error(
+				"outbox claim error",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.Name()),
+				zap.String("uuid", actor.UUID()),
+				zap.String("error", err.Error()),
+			)
+		}
+	}
 
-	return actor, nil
+	return actor.(*localActor), recovered, nil
 }
 
 // --- Actor interface functions ---
 
-// Backup backups message into local sqlite db
+// Backup backups message into actor's BackupStore
+//
+// message is queued and written in batch if actor is created with
+// WithBatchBackup option
 func (actor *localActor) Backup(msg string) {
-	if actor.db != nil {
-		if err := actor.db.Insert(msg); err != nil {
-			GetLog().Error(
+	if actor.store != nil {
+		insert := actor.store.Insert
+		if actor.batch != nil {
+			insert = actor.batch.Insert
+		}
+
+		start := time.Now()
+
+		msg, err := actor.encoding.encode(msg)
+		if err == nil {
+			err = insert(msg)
+		}
+
+		if m := getMetrics(); m != nil {
+			// batched inserts are measured by batch writer
+			if actor.batch == nil {
+				m.Observe(MetricBackupLatency, actor.name, time.Since(start).Seconds())
+			}
+
+			if err != nil {
+				m.Count(MetricBackupErrors, actor.name, 1)
+			}
+		}
+
+		if err != nil {
+			actor.log().Error(
 				"backup actor message error",
 				zap.String("service", serviceName),
 				zap.String("actor", actor.name),
@@ -139,6 +321,74 @@ func (actor *localActor) Backup(msg string) {
 	}
 }
 
+// Flush blocks until queued backup messages are written
+//
+// returns the first backup write error since last Flush, noop if actor is
+// not created with WithBatchBackup option
+func (actor *localActor) Flush() error {
+	if actor.batch == nil {
+		return nil
+	}
+
+	return actor.batch.Flush()
+}
+
+// SaveSnapshot serializes state with actor's codec and stores it as snapshot
+//
+// only the latest snapshots set by WithSnapshotRetention are preserved
+func (actor *localActor) SaveSnapshot(state interface{}) error {
+	ss, err := actor.snapshotStore()
+	if err != nil {
+		return err
+	}
+
+	data, err := actor.codec.Marshal(state)
+	if err != nil {
+		actor.log().Error(
+			"snapshot marshal error",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.name),
+			zap.String("uuid", actor.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	return ss.SaveSnapshot(actor.codec.Name(), data, actor.snapshotKeep)
+}
+
+// LoadLatestSnapshot restores the latest snapshot into state
+//
+// snapshots stored by previous actor instances with the same name are
+// considered, thus a restarted actor recovers without replaying backups
+func (actor *localActor) LoadLatestSnapshot(state interface{}) error {
+	ss, err := actor.snapshotStore()
+	if err != nil {
+		return err
+	}
+
+	codec, b, err := ss.LoadLatestSnapshot()
+	if err != nil {
+		return err
+	}
+
+	if codec != actor.codec.Name() {
+		actor.log().Error(
+			"snapshot codec mismatch",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.name),
+			zap.String("uuid", actor.uuid),
+			zap.String("codec", actor.codec.Name()),
+			zap.String("snapshot codec", codec),
+		)
+
+		return ErrSnapshotCodec
+	}
+
+	return actor.codec.Unmarshal(b, state)
+}
+
 // Done Actor's context.done()
 //
 // context.done() is used for cleaning up Actor resource
@@ -148,6 +398,10 @@ func (actor *localActor) Done() <-chan struct{} {
 
 // Idle returns actor's idle time
 func (actor *localActor) Idle() time.Duration {
+	if actor.dispatched() {
+		return time.Since(time.Unix(0, atomic.LoadInt64(&actor.lastActive)))
+	}
+
 	return time.Duration(atomic.LoadInt64(&actor.idle))
 }
 
@@ -157,12 +411,106 @@ func (actor *localActor) Name() string {
 }
 
 // Receive receives message from actor
+//
+// panics if actor is created with WithRingMailbox option, use ReceiveBatch
 func (actor *localActor) Receive() <-chan interface{} {
+	if actor.ring != nil {
+		panic(ErrRingReceive)
+	}
+
 	return actor.receive
 }
 
+// ReceiveBatch receives up to len(buf) messages into buf, blocks until at
+// least one message is received
+//
+// returns number of received messages, 0 once actor is cancelled
+func (actor *localActor) ReceiveBatch(buf []interface{}) int {
+	if len(buf) == 0 {
+		return 0
+	}
+
+	n := actor.receiveBatch(buf)
+
+	if m := getMetrics(); m != nil && n > 0 {
+		actor.recordReceived(m)
+	}
+
+	return n
+}
+
+func (actor *localActor) receiveBatch(buf []interface{}) int {
+	if actor.ring != nil {
+		n, _ := actor.ring.Receive(actor.ctx, buf)
+		return n
+	}
+
+	select {
+	case <-actor.Done():
+		return 0
+	case buf[0] = <-actor.receive:
+	}
+
+	n := 1
+	for ; n < len(buf); n++ {
+		select {
+		case buf[n] = <-actor.receive:
+		default:
+			return n
+		}
+	}
+
+	return n
+}
+
 // Send sends message to actor
-func (actor *localActor) Send(message interface{}) (err error) {
+//
+// message is stored before delivery and delivered as *Envelope if actor is
+// created with WithDurableMailbox option
+//
+// *Envelope is delivered as a copy, dropped if its ID is seen by actor
+// created with WithDedup option, waits while its ID is in flight
+func (actor *localActor) Send(message interface{}) error {
+	return actor.post(nil, message)
+}
+
+// SendContext sends message with ctx to actor
+//
+// message is delivered as *Envelope carries ctx, handler gets ctx by
+// Envelope.Context and propagates it by forwarding with SendContext.
+// ctx's deadline and propagated values are injected into Envelope.Header for
+// remote transports.
+//
+// returns ctx.Err() if ctx is done before message is delivered
+func (actor *localActor) SendContext(ctx context.Context, message interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	env, ok := message.(*Envelope)
+	if !ok {
+		env = NewEnvelope(message)
+		env.Path = pathFromContext(ctx)
+	} else {
+		e := *env
+		env = &e
+	}
+
+	header := make(Header, len(env.Header))
+	for k, v := range env.Header {
+		header[k] = v
+	}
+
+	env.ctx = ctx
+	env.Header = InjectContext(ctx, header)
+
+	return actor.post(ctx, env)
+}
+
+// post delivers message, blocks until delivered or ctx is done
+//
+// ctx: nil: blocks until delivered
+func (actor *localActor) post(ctx context.Context, message interface{}) (err error) {
 	// defer func() {
 	// if r := recover(); r != nil {
 	// GetLog().Error(
@@ -179,7 +527,7 @@ func (actor *localActor) Send(message interface{}) (err error) {
 
 	select {
 	case <-actor.Done():
-		GetLog().Error(
+		actor.log().Error(
 			"actor is cancelled",
 			zap.String("service", serviceName),
 			zap.String("actor", actor.name),
@@ -190,21 +538,158 @@ func (actor *localActor) Send(message interface{}) (err error) {
 		err = ErrChannelClosed
 		return
 	default:
+		var env *Envelope
+
+		// sender observed by topology, empty: unknown
+		from := senderFromContext(ctx)
+
+		if v, ok := message.(*Envelope); ok {
+			if v.actor != nil {
+				from = v.actor.name
+			}
+
+			// receiving actor owns the delivered copy
+			e := *v
+			e.actor = actor
+			env = &e
+			message = env
+
+			// forwarded by the actor received it
+			if path := v.forwardPath(); path != nil {
+				e.Path = path
+			}
+
+			if actor.dedup != nil && e.ID != "" {
+				dup, derr := actor.duplicated(ctx, e.ID)
+				if dup || derr != nil {
+					return derr
+				}
+
+				// id is remembered only if message is delivered
+				defer actor.settle(e.ID, &err)
+			}
+
+			if exp := getSpanExporter(); exp != nil {
+				defer actor.traceSend(ctx, env, exp)()
+			}
+		}
+
+		if actor.mailbox != nil {
+			e, err := actor.enqueue(message)
+			if err != nil {
+				return err
+			}
+
+			env = e
+			message = env
+		}
+
+		if env != nil {
+			env.sent = time.Now()
+		}
+
+		if err := actor.push(ctx, message); err != nil {
+			return err
+		}
+
+		actor.resetIdle()
+
+		if from != "" {
+			actor.observe(from)
+		}
+
+		if m := getMetrics(); m != nil {
+			m.Count(MetricSent, actor.name, 1)
+			m.Gauge(MetricMailboxDepth, actor.name, float64(actor.mailboxLen()))
+			m.Gauge(MetricIdle, actor.name, 0)
+			actor.recordReceived(m)
+		}
+
+		if logEvent(LogSend) {
+			var path []string
+			if env != nil {
+				path = env.Path
+			}
+
+			actor.log().Debug(
+				"send",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.Name()),
+				zap.String("uuid", actor.UUID()),
+				zap.Any("message", message),
+				zap.Strings("path", path),
+			)
+		}
+
+		return
+	}
+}
+
+// push delivers message into actor's mailbox
+//
+// ctx: nil: blocks until delivered
+func (actor *localActor) push(ctx context.Context, message interface{}) error {
+	if err := actor.pushMailbox(ctx, message); err != nil {
+		return err
+	}
+
+	atomic.AddUint64(&actor.delivered, 1)
+
+	return nil
+}
+
+func (actor *localActor) pushMailbox(ctx context.Context, message interface{}) error {
+	if actor.ring != nil {
+		if ctx == nil {
+			ctx = actor.ctx
+		}
+
+		if err := actor.ring.Send(ctx, message); err != nil {
+			if err == context.Canceled && ctx == actor.ctx {
+				return ErrChannelClosed
+			}
+
+			return err
+		}
+
+		if actor.dispatched() {
+			actor.options.dispatcher.schedule(actor)
+		}
+
+		return nil
+	}
+
+	if ctx == nil {
 		// block, force golang scheduler to process message.
 		// do not use select on purpose.
 		actor.send <- message
-		actor.resetIdle()
+		return nil
+	}
 
-		GetLog().Debug(
-			"send",
-			zap.String("service", serviceName),
-			zap.String("actor", actor.Name()),
-			zap.String("uuid", actor.UUID()),
-			zap.Any("message", message),
-		)
+	select {
+	case actor.send <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-		return
+// mailboxLen returns number of messages waiting in actor's mailbox
+func (actor *localActor) mailboxLen() int {
+	if actor.ring != nil {
+		return actor.ring.Len()
 	}
+
+	return len(actor.send)
+}
+
+// mailboxCap returns capacity of actor's mailbox
+func (actor *localActor) mailboxCap() int {
+	if actor.ring != nil {
+		return actor.ring.Cap()
+	}
+
+	return cap(actor.send)
 }
 
 // UUID returns actor's UUID
@@ -212,9 +697,87 @@ func (actor *localActor) UUID() string {
 	return actor.uuid
 }
 
+// duplicated reports whether message id is delivered within dedup window,
+// claims delivery of id otherwise
+//
+// waits while message with the same id is in flight, thus it is delivered
+// if the in-flight delivery fails.
+//
+// returns ctx.Err() if ctx is done while waiting
+func (actor *localActor) duplicated(ctx context.Context, id string) (bool, error) {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	for {
+		claimed, settled := actor.dedup.claim(id)
+		if claimed {
+			return false, nil
+		}
+
+		if settled == nil {
+			break
+		}
+
+		select {
+		case <-settled:
+		case <-done:
+			return false, ctx.Err()
+		}
+	}
+
+	actor.log().Debug(
+		"duplicated message dropped",
+		zap.String("service", serviceName),
+		zap.String("actor", actor.name),
+		zap.String("uuid", actor.uuid),
+		zap.String("message id", id),
+	)
+
+	return true, nil
+}
+
+// settle persists message id once delivered, forgets it if delivery failed
+// by err, thus retried message with the same id is delivered
+func (actor *localActor) settle(id string, err *error) {
+	if *err != nil {
+		actor.dedup.forget(id)
+		return
+	}
+
+	if e := actor.dedup.commit(id); e != nil {
+		actor.log().Error(
+			"dedup persist error",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.name),
+			zap.String("uuid", actor.uuid),
+			zap.String("message id", id),
+			zap.String("error", e.Error()),
+		)
+	}
+}
+
+func (actor *localActor) snapshotStore() (SnapshotStore, error) {
+	if actor.store == nil {
+		return nil, ErrBackupDisabled
+	}
+
+	ss, ok := actor.store.(SnapshotStore)
+	if !ok {
+		return nil, ErrSnapshotUnsupported
+	}
+
+	return ss, nil
+}
+
 func (actor *localActor) close() {
 	actor.cancel()
 
+	if actor.ring != nil {
+		actor.ring.Close()
+	}
+
 	// https://stackoverflow.com/a/8593986 Not a precise answer but ok.
 	// do not close actor's channel avoid race condition
 	// it's not a resource leak if channel remains open
@@ -246,7 +809,12 @@ func (actor *localActor) increaseIdle() {
 				int64(time.Duration(passed.Second())*time.Second),
 			)
 
-			GetLog().Debug(
+			if m := getMetrics(); m != nil {
+				m.Gauge(MetricIdle, actor.name, actor.Idle().Seconds())
+				actor.recordReceived(m)
+			}
+
+			actor.log().Debug(
 				"actor idle seconds",
 				zap.String("service", serviceName),
 				zap.String("actor", actor.name),
@@ -261,13 +829,17 @@ func (actor *localActor) increaseIdle() {
 }
 
 func (actor *localActor) startStamp() {
+	actor.stampLock.Lock()
 	actor.startTime = time.Now()
+	actor.stampLock.Unlock()
 
-	if actor.db != nil {
-		actor.db.Start(actor.startTime)
+	if actor.store != nil {
+		actor.store.Start(actor.startTime)
 	}
 
-	GetLog().Info(
+	actor.recordStart()
+
+	actor.log().Info(
 		"actor start time",
 		zap.String("service", serviceName),
 		zap.String("actor", actor.name),
@@ -277,14 +849,21 @@ func (actor *localActor) startStamp() {
 }
 
 func (actor *localActor) endStamp() {
+	actor.stampLock.Lock()
 	actor.endTime = time.Now()
+	actor.stampLock.Unlock()
+
+	// queued backup messages are written before actor stops
+	if actor.batch != nil {
+		actor.batch.Close()
+	}
 
-	if actor.db != nil {
-		actor.db.Stop(actor.endTime)
-		actor.db.Close()
+	if actor.store != nil {
+		actor.store.Stop(actor.endTime)
+		actor.store.Close()
 	}
 
-	GetLog().Info(
+	actor.log().Info(
 		"actor end time",
 		zap.String("service", serviceName),
 		zap.String("actor", actor.name),
@@ -293,3 +872,38 @@ func (actor *localActor) endStamp() {
 	)
 
 }
+
+// reportPanic logs and publishes handler panic, along with the message
+// processed by handler
+func (actor *localActor) reportPanic(r interface{}) {
+	env, _ := actor.handling.Load().(*Envelope)
+
+	fields := []zap.Field{
+		zap.String("service", serviceName),
+		zap.String("actor", actor.name),
+		zap.String("uuid", actor.uuid),
+		zap.Any("panic", r),
+	}
+
+	if env != nil {
+		fields = append(
+			fields,
+			zap.String("message id", env.ID),
+			zap.Strings("path", env.Path),
+		)
+	}
+
+	actor.log().Error("actor handler panic", fields...)
+
+	if m := getMetrics(); m != nil {
+		m.Count(MetricPanics, actor.name, 1)
+	}
+
+	publish(Panic{
+		Actor:    actor.name,
+		UUID:     actor.uuid,
+		Reason:   r,
+		Envelope: env,
+		Time:     time.Now(),
+	})
+}
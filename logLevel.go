@@ -0,0 +1,234 @@
+package actor
+
+import (
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogEvent is a kind of verbose log, disabled by default
+type LogEvent uint32
+
+// verbose log events
+const (
+	// LogSend logs each delivered message at debug level
+	LogSend LogEvent = 1 << iota
+	// LogLookup logs each actor retrieved by Get, GetByName and GetByUUID
+	LogLookup
+	// LogRegistration logs each actor registered and deregistered
+	LogRegistration
+)
+
+// cached level of actorLogger: no level rule matches actor's name
+const noLevel = 0xff
+
+type (
+	levelRule struct {
+		pattern string
+		level   zapcore.Level
+	}
+
+	// samplePolicy logs the first messages per second, then every
+	// thereafter message
+	samplePolicy struct {
+		first      uint64
+		thereafter uint64
+		second     int64  // atomic, current second
+		count      uint64 // atomic, messages within current second
+	}
+
+	// actorLogger filters actor's logs by per-actor log level and sampling
+	// policy
+	actorLogger struct {
+		name   string
+		logger l.ServiceLogger // set by WithLogger, nil: service logger
+		cached uint64          // atomic, (rules version + 1) << 8 | (level + 1)
+	}
+)
+
+var (
+	logEvents uint32 // atomic, enabled LogEvent
+
+	levelLock    sync.RWMutex
+	levelRules   []levelRule
+	levelVersion uint64 // atomic, increased when levelRules change
+
+	// log message -> *samplePolicy
+	sampling sync.Map
+)
+
+// SetLogEvents enables verbose log events, e.g. LogSend|LogLookup, 0
+// disables all
+//
+// verbose logs are built only if enabled, thus message passing does not
+// allocate for logging by default.
+func SetLogEvents(events LogEvent) {
+	atomic.StoreUint32(&logEvents, uint32(events))
+}
+
+func logEvent(e LogEvent) bool {
+	return LogEvent(atomic.LoadUint32(&logEvents))&e != 0
+}
+
+// SetActorLogLevel overrides log level of actors with name matches pattern
+//
+// pattern is matched by path.Match, e.g. "pipe*". The latest set matching
+// pattern applies. Overridden level is effective even below service log
+// level set by SetLoggingLevel, if actor logs with service's default
+// logger.
+func SetActorLogLevel(pattern string, level zapcore.Level) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+
+	defer levelLock.Unlock()
+	levelLock.Lock()
+
+	levelRules = append(levelRules, levelRule{pattern, level})
+	atomic.AddUint64(&levelVersion, 1)
+
+	return nil
+}
+
+// ResetActorLogLevels removes log levels set by SetActorLogLevel
+func ResetActorLogLevels() {
+	defer levelLock.Unlock()
+	levelLock.Lock()
+
+	levelRules = nil
+	atomic.AddUint64(&levelVersion, 1)
+}
+
+// SetLogSampling samples actor logs of message per second, e.g. "send"
+//
+// the first messages per second are logged, then every thereafter message.
+// first < 0 removes the policy.
+//
+// thereafter: <= 0: drop messages after the first messages
+func SetLogSampling(msg string, first, thereafter int) {
+	if first < 0 {
+		sampling.Delete(msg)
+		return
+	}
+
+	if thereafter < 0 {
+		thereafter = 0
+	}
+
+	sampling.Store(msg, &samplePolicy{
+		first:      uint64(first),
+		thereafter: uint64(thereafter),
+	})
+}
+
+// sampled reports whether message is logged by its sampling policy
+func sampled(msg string) bool {
+	v, ok := sampling.Load(msg)
+	if !ok {
+		return true
+	}
+
+	p := v.(*samplePolicy)
+
+	now := time.Now().Unix()
+	if s := atomic.LoadInt64(&p.second); s != now &&
+		atomic.CompareAndSwapInt64(&p.second, s, now) {
+		atomic.StoreUint64(&p.count, 0)
+	}
+
+	n := atomic.AddUint64(&p.count, 1)
+	if n <= p.first {
+		return true
+	}
+
+	return p.thereafter > 0 && (n-p.first)%p.thereafter == 0
+}
+
+func newActorLogger(name string, logger Logger) *actorLogger {
+	return &actorLogger{name: name, logger: serviceLogger(logger)}
+}
+
+// override returns log level set for actor by SetActorLogLevel
+func (a *actorLogger) override() (zapcore.Level, bool) {
+	version := atomic.LoadUint64(&levelVersion)
+
+	cached := atomic.LoadUint64(&a.cached)
+	if cached>>8 != version+1 {
+		level := uint64(noLevel)
+
+		levelLock.RLock()
+		for idx := len(levelRules) - 1; idx >= 0; idx-- {
+			if ok, _ := path.Match(levelRules[idx].pattern, a.name); ok {
+				level = uint64(levelRules[idx].level + 1)
+				break
+			}
+		}
+		levelLock.RUnlock()
+
+		cached = (version+1)<<8 | level
+		atomic.StoreUint64(&a.cached, cached)
+	}
+
+	if cached&0xff == noLevel {
+		return 0, false
+	}
+
+	return zapcore.Level(cached&0xff) - 1, true
+}
+
+// check returns logger logs msg at level, false if filtered
+func (a *actorLogger) check(level zapcore.Level, msg string) (l.ServiceLogger, bool) {
+	min, ok := a.override()
+	if ok && level < min {
+		return nil, false
+	}
+
+	if !sampled(msg) {
+		return nil, false
+	}
+
+	if a.logger != nil {
+		return a.logger, true
+	}
+
+	if ok {
+		return l.GetRawLog(), true
+	}
+
+	return l.GetLog(), true
+}
+
+func (a *actorLogger) Debug(msg string, fields ...zap.Field) {
+	if logger, ok := a.check(zapcore.DebugLevel, msg); ok {
+		logger.Debug(msg, fields...)
+	}
+}
+
+func (a *actorLogger) Info(msg string, fields ...zap.Field) {
+	if logger, ok := a.check(zapcore.InfoLevel, msg); ok {
+		logger.Info(msg, fields...)
+	}
+}
+
+func (a *actorLogger) Warn(msg string, fields ...zap.Field) {
+	if logger, ok := a.check(zapcore.WarnLevel, msg); ok {
+		logger.Warn(msg, fields...)
+	}
+}
+
+func (a *actorLogger) Error(msg string, fields ...zap.Field) {
+	if logger, ok := a.check(zapcore.ErrorLevel, msg); ok {
+		logger.Error(msg, fields...)
+	}
+}
+
+// log returns actor's logger
+func (actor *localActor) log() l.ServiceLogger {
+	return actor.actorLog
+}
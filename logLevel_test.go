@@ -0,0 +1,139 @@
+package actor_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// debugLogger returns Logger logs every level into buf
+func debugLogger(buf *logBuffer) actor.Logger {
+	return actor.NewSlogLogger(slog.New(slog.NewJSONHandler(
+		buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+}
+
+func TestSendAllocations(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc := createTestCase(1, 0, -1)[0]
+	act, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) {
+			for {
+				select {
+				case <-act.Done():
+					return
+				case <-act.Receive():
+				}
+			}
+		},
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	msg := &struct{}{}
+
+	if n := testing.AllocsPerRun(100, func() { act.Send(msg) }); n != 0 {
+		t.Fatalf("expecting: 0 allocations per Send, receiving: %v", n)
+	}
+}
+
+func TestActorLogLevel(t *testing.T) {
+	defer actor.ResetActorLogLevels()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(2, 0, -1)
+
+	if err := actor.SetActorLogLevel("[", zapcore.ErrorLevel); err == nil {
+		t.Fatal("expecting: malformed pattern error")
+	}
+
+	// only the first actor logs errors only
+	if err := actor.SetActorLogLevel(cases[0].name[:8]+"*", zapcore.DebugLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := actor.SetActorLogLevel(cases[0].name, zapcore.ErrorLevel); err != nil {
+		t.Fatal(err)
+	}
+
+	bufs := make([]*logBuffer, len(cases))
+
+	for idx, tc := range cases {
+		bufs[idx] = &logBuffer{}
+
+		_, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithLogger(debugLogger(bufs[idx])),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+	}
+
+	for idx := 0; idx < 100 && !strings.Contains(bufs[1].String(), "actor start time"); idx++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if logs := bufs[0].String(); strings.Contains(logs, "actor start time") {
+		t.Fatalf("expecting: info logs filtered, receiving:\n%s", logs)
+	}
+
+	if logs := bufs[1].String(); !strings.Contains(logs, "actor start time") {
+		t.Fatalf("expecting: info logs, receiving:\n%s", logs)
+	}
+}
+
+func TestLogEventsAndSampling(t *testing.T) {
+	actor.SetLogEvents(actor.LogSend)
+	defer actor.SetLogEvents(0)
+
+	actor.SetLogSampling("send", 2, 0)
+	defer actor.SetLogSampling("send", -1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var buf logBuffer
+
+	tc := createTestCase(1, 10, -1)[0]
+	act, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+		actor.WithLogger(debugLogger(&buf)),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	for idx := 0; idx < 10; idx++ {
+		if err := act.Send(idx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// sampling window may restart once within the sends
+	if n := strings.Count(buf.String(), `"msg":"send"`); n < 2 || n > 4 {
+		t.Fatalf("expecting: 2 sampled send logs, receiving: %d", n)
+	}
+}
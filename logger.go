@@ -1,14 +1,189 @@
 package actor
 
 import (
+	"context"
+	"log/slog"
+
 	l "github.com/vsdmars/actor/internal/logger"
 
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+type (
+	// Field is a structured log field
+	Field struct {
+		Key   string
+		Value interface{}
+	}
+
+	// Logger is the structured logger used by actors
+	//
+	// Logger does not depend on a logging library, use ZapLogger,
+	// NewSlogLogger or NopLogger adapters, or implement Logger for other
+	// loggers.
+	Logger interface {
+		Debug(msg string, fields ...Field)
+		Info(msg string, fields ...Field)
+		Warn(msg string, fields ...Field)
+		Error(msg string, fields ...Field)
+	}
+
+	zapLogger struct {
+		logger *zap.Logger
+	}
+
+	slogLogger struct {
+		logger *slog.Logger
+	}
+
+	nopLogger struct{}
+
+	// fieldLogger logs service's zap fields with Logger
+	fieldLogger struct {
+		logger Logger
+	}
+)
+
 // SetLoggingLevel sets the service log level
 //
-// noop if caller provides it's own zap logger
+// noop if caller provides it's own logger
 func SetLoggingLevel(level zapcore.Level) {
 	l.SetLogLevel(level)
 }
+
+// SetLogger sets the logger used by actors without WithLogger option and by
+// backup stores
+//
+// reset to the default JSON logger writes to stderr by passing in nil
+func SetLogger(logger Logger) {
+	l.SetServiceLogger(serviceLogger(logger))
+}
+
+// ZapLogger returns Logger logs with zap logger
+//
+// fields are converted by zap.Any.
+func ZapLogger(logger *zap.Logger) Logger {
+	return zapLogger{logger}
+}
+
+// NewSlogLogger returns Logger logs with log/slog logger
+//
+// fields are converted by slog.Any.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger}
+}
+
+// NopLogger returns Logger discards logs
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+// serviceLogger returns service logger logs with logger, nil if logger is
+// nil
+//
+// zap logger is used directly, fields of other loggers are converted.
+func serviceLogger(logger Logger) l.ServiceLogger {
+	switch lg := logger.(type) {
+	case nil:
+		return nil
+	case zapLogger:
+		return lg.logger
+	case nopLogger:
+		return zap.NewNop()
+	default:
+		return fieldLogger{lg}
+	}
+}
+
+func zapFields(fields []Field) []zap.Field {
+	zfs := make([]zap.Field, 0, len(fields))
+
+	for _, f := range fields {
+		zfs = append(zfs, zap.Any(f.Key, f.Value))
+	}
+
+	return zfs
+}
+
+func (z zapLogger) Debug(msg string, fields ...Field) {
+	z.logger.Debug(msg, zapFields(fields)...)
+}
+
+func (z zapLogger) Info(msg string, fields ...Field) {
+	z.logger.Info(msg, zapFields(fields)...)
+}
+
+func (z zapLogger) Warn(msg string, fields ...Field) {
+	z.logger.Warn(msg, zapFields(fields)...)
+}
+
+func (z zapLogger) Error(msg string, fields ...Field) {
+	z.logger.Error(msg, zapFields(fields)...)
+}
+
+func (s slogLogger) log(level slog.Level, msg string, fields []Field) {
+	ctx := context.Background()
+
+	if !s.logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, len(fields))
+
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+
+	s.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (s slogLogger) Debug(msg string, fields ...Field) {
+	s.log(slog.LevelDebug, msg, fields)
+}
+
+func (s slogLogger) Info(msg string, fields ...Field) {
+	s.log(slog.LevelInfo, msg, fields)
+}
+
+func (s slogLogger) Warn(msg string, fields ...Field) {
+	s.log(slog.LevelWarn, msg, fields)
+}
+
+func (s slogLogger) Error(msg string, fields ...Field) {
+	s.log(slog.LevelError, msg, fields)
+}
+
+func (nopLogger) Debug(string, ...Field) {}
+func (nopLogger) Info(string, ...Field)  {}
+func (nopLogger) Warn(string, ...Field)  {}
+func (nopLogger) Error(string, ...Field) {}
+
+// fields converts zap fields into Field
+func (f fieldLogger) fields(zfs []zap.Field) []Field {
+	enc := zapcore.NewMapObjectEncoder()
+	fields := make([]Field, 0, len(zfs))
+
+	for _, zf := range zfs {
+		zf.AddTo(enc)
+		fields = append(fields, Field{zf.Key, enc.Fields[zf.Key]})
+	}
+
+	return fields
+}
+
+func (f fieldLogger) Debug(msg string, fields ...zap.Field) {
+	f.logger.Debug(msg, f.fields(fields)...)
+}
+
+func (f fieldLogger) Info(msg string, fields ...zap.Field) {
+	f.logger.Info(msg, f.fields(fields)...)
+}
+
+func (f fieldLogger) Warn(msg string, fields ...zap.Field) {
+	f.logger.Warn(msg, f.fields(fields)...)
+}
+
+func (f fieldLogger) Error(msg string, fields ...zap.Field) {
+	f.logger.Error(msg, f.fields(fields)...)
+}
@@ -0,0 +1,180 @@
+package actor_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fieldRecorder is Logger records fields of info logs
+type fieldRecorder struct {
+	lock sync.Mutex
+	logs map[string][]actor.Field
+}
+
+func (r *fieldRecorder) Debug(string, ...actor.Field) {}
+func (r *fieldRecorder) Warn(string, ...actor.Field)  {}
+func (r *fieldRecorder) Error(string, ...actor.Field) {}
+
+func (r *fieldRecorder) Info(msg string, fields ...actor.Field) {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+
+	r.logs[msg] = fields
+}
+
+func (r *fieldRecorder) fields(msg string) []actor.Field {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+
+	return r.logs[msg]
+}
+
+// logBuffer is io.Writer safe for concurrent use
+type logBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	defer b.lock.Unlock()
+	b.lock.Lock()
+
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	defer b.lock.Unlock()
+	b.lock.Lock()
+
+	return b.buf.String()
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf logBuffer
+
+	logger := actor.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	logger.Debug("filtered")
+	logger.Error(
+		"slog error",
+		actor.Field{Key: "actor", Value: "a"},
+		actor.Field{Key: "attempt", Value: 3},
+		actor.Field{Key: "path", Value: []string{"p1", "p2"}},
+	)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(buf.String()), &record); err != nil {
+		t.Fatalf("expecting: a single JSON record, receiving: %s", buf.String())
+	}
+
+	if record["msg"] != "slog error" || record["level"] != "ERROR" ||
+		record["actor"] != "a" || record["attempt"] != float64(3) {
+		t.Fatalf("expecting: converted fields, receiving: %v", record)
+	}
+
+	if path, ok := record["path"].([]interface{}); !ok || len(path) != 2 {
+		t.Fatalf("expecting: path [p1 p2], receiving: %v", record["path"])
+	}
+}
+
+func TestActorLogger(t *testing.T) {
+	// service logger is replaced, actor logs with its own logger
+	actor.SetLogger(actor.NopLogger())
+	defer actor.SetLogger(nil)
+
+	var buf logBuffer
+	logger := actor.NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	tc := createTestCase(1, 0, -1)[0]
+	_, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+		actor.WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	cancel()
+	waitDeregister(t, tc.name)
+
+	for idx := 0; idx < 100 && !strings.Contains(buf.String(), "actor end time"); idx++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	logs := buf.String()
+	for _, msg := range []string{"actor start time", "actor end time", tc.name} {
+		if !strings.Contains(logs, msg) {
+			t.Fatalf("expecting: %q in\n%s", msg, logs)
+		}
+	}
+}
+
+func TestZapLogger(t *testing.T) {
+	var buf logBuffer
+
+	logger := actor.ZapLogger(zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zapcore.DebugLevel,
+	)))
+	logger.Info("zap info", actor.Field{Key: "attempt", Value: 3})
+
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(buf.String()), &record); err != nil {
+		t.Fatalf("expecting: a single JSON record, receiving: %s", buf.String())
+	}
+
+	if record["msg"] != "zap info" || record["attempt"] != float64(3) {
+		t.Fatalf("expecting: converted fields, receiving: %v", record)
+	}
+}
+
+func TestCustomLogger(t *testing.T) {
+	logger := &fieldRecorder{logs: make(map[string][]actor.Field)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc := createTestCase(1, 0, -1)[0]
+	_, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+		actor.WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	var fields []actor.Field
+	for idx := 0; idx < 100 && fields == nil; idx++ {
+		time.Sleep(10 * time.Millisecond)
+		fields = logger.fields("actor start time")
+	}
+
+	for _, f := range fields {
+		if f.Key == "actor" && f.Value == tc.name {
+			return
+		}
+	}
+
+	t.Fatalf("expecting: actor field %s, receiving: %v", tc.name, fields)
+}
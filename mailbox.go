@@ -0,0 +1,200 @@
+package actor
+
+import (
+	"time"
+
+	idb "github.com/vsdmars/actor/internal/db"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// dead letter reasons
+const (
+	reasonMaxAttempts = "max attempts exceeded"
+)
+
+type (
+	// MailboxEntry is a message stored in durable mailbox
+	MailboxEntry = idb.Mail
+
+	// MailboxStore is implemented by BackupStore supports durable mailbox
+	MailboxStore interface {
+		// Enqueue stores message before delivery, recorded as delivered once
+		Enqueue(id, codec string, payload []byte) error
+		// Ack removes processed message
+		Ack(id string) error
+		// Attempt increases message's delivery attempts, returns attempts
+		Attempt(id string) (int, error)
+		// DeadLetter moves message into dead letter queue
+		DeadLetter(id, reason string) error
+		// Recover claims unacknowledged messages left by previous actor
+		// instances with the same name, ordered by enqueue time
+		Recover() ([]MailboxEntry, error)
+		// DeadLetters returns dead letters of actor instances with the same
+		// name
+		DeadLetters() ([]MailboxEntry, error)
+	}
+)
+
+// DeadLetters returns messages moved into dead letter queue by actor
+// instances with the same name
+func (actor *localActor) DeadLetters() ([]*Envelope, error) {
+	if actor.mailbox == nil {
+		return nil, ErrMailboxDisabled
+	}
+
+	entries, err := actor.mailbox.DeadLetters()
+	if err != nil {
+		return nil, err
+	}
+
+	envs := make([]*Envelope, 0, len(entries))
+	for _, entry := range entries {
+		envs = append(envs, actor.restore(entry))
+	}
+
+	return envs, nil
+}
+
+// enqueue stores message into durable mailbox, returns envelope delivered
+//
+// message id of *Envelope is preserved
+func (actor *localActor) enqueue(message interface{}) (*Envelope, error) {
+	env, ok := message.(*Envelope)
+	if !ok {
+		env = NewEnvelope(message)
+	} else if env.ID == "" {
+		env.ID = uuid.New().String()
+	}
+
+	payload, err := actor.codec.Marshal(env.Message)
+	if err != nil {
+		actor.log().Error(
+			"mailbox message marshal error",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.name),
+			zap.String("uuid", actor.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return nil, err
+	}
+
+	env.Attempt = 1
+	env.codec = actor.codec.Name()
+	env.payload = payload
+	env.actor = actor
+
+	if err := actor.mailbox.Enqueue(env.ID, env.codec, payload); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// restore returns envelope of stored message
+func (actor *localActor) restore(entry MailboxEntry) *Envelope {
+	env := &Envelope{
+		ID:      entry.ID,
+		Attempt: entry.Attempts,
+		codec:   entry.Codec,
+		payload: entry.Payload,
+		actor:   actor,
+	}
+
+	var msg interface{}
+	if env.Decode(&msg) == nil {
+		env.Message = msg
+	}
+
+	return env
+}
+
+// redeliver delivers messages recovered from previous actor instances
+func (actor *localActor) redeliver(entries []MailboxEntry) {
+	for _, entry := range entries {
+		env := actor.restore(entry)
+
+		if actor.maxAttempts > 0 && env.Attempt >= actor.maxAttempts {
+			actor.deadLetter(env, reasonMaxAttempts)
+			continue
+		}
+
+		if err := actor.attempt(env); err != nil {
+			continue
+		}
+
+		actor.deliver(env)
+	}
+}
+
+// retry redelivers message or moves it into dead letter queue
+func (actor *localActor) retry(env *Envelope, reason string) error {
+	if actor.maxAttempts > 0 && env.Attempt >= actor.maxAttempts {
+		return actor.deadLetter(env, reason)
+	}
+
+	if err := actor.attempt(env); err != nil {
+		return err
+	}
+
+	// handler may be the only receiver, do not block it
+	go actor.deliver(env)
+
+	return nil
+}
+
+// attempt records a new delivery attempt of envelope
+func (actor *localActor) attempt(env *Envelope) error {
+	attempts, err := actor.mailbox.Attempt(env.ID)
+	if err != nil {
+		actor.log().Error(
+			"mailbox attempt error",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.name),
+			zap.String("uuid", actor.uuid),
+			zap.String("message id", env.ID),
+			zap.String("error", err.Error()),
+		)
+
+		return err
+	}
+
+	env.Attempt = attempts
+
+	return nil
+}
+
+// deliver pushes envelope into actor's mailbox until actor is cancelled
+func (actor *localActor) deliver(env *Envelope) {
+	if actor.push(actor.ctx, env) == nil {
+		actor.resetIdle()
+	}
+}
+
+// deadLetter moves envelope into dead letter queue
+func (actor *localActor) deadLetter(env *Envelope, reason string) error {
+	err := actor.mailbox.DeadLetter(env.ID, reason)
+
+	actor.log().Error(
+		"mailbox dead letter",
+		zap.String("service", serviceName),
+		zap.String("actor", actor.name),
+		zap.String("uuid", actor.uuid),
+		zap.String("message id", env.ID),
+		zap.Int("attempt", env.Attempt),
+		zap.Strings("path", env.Path),
+		zap.String("reason", reason),
+	)
+
+	publish(DeadLetter{
+		Actor:    actor.name,
+		UUID:     actor.uuid,
+		Envelope: env,
+		Reason:   reason,
+		Time:     time.Now(),
+	})
+
+	return err
+}
@@ -0,0 +1,182 @@
+package actor_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func receiveEnvelope(t *testing.T, act actor.Actor) *actor.Envelope {
+	select {
+	case msg := <-act.Receive():
+		env, ok := msg.(*actor.Envelope)
+		if !ok {
+			t.Fatalf("expecting: *actor.Envelope, receiving: %T", msg)
+		}
+
+		return env
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	return nil
+}
+
+func TestDurableMailbox(t *testing.T) {
+	mem := actor.NewMemoryBackup()
+
+	for _, tc := range createTestCase(1, 10, 0) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+			actor.WithDurableMailbox(0),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 1; idx <= 3; idx++ {
+			if err := act.Send(fmt.Sprintf("message %d", idx)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		env := receiveEnvelope(t, act)
+		if env.Message != "message 1" || env.Attempt != 1 {
+			t.Errorf("expecting: message 1 attempt 1, receiving: %v %d", env.Message, env.Attempt)
+		}
+
+		if err := env.Ack(); err != nil {
+			t.Fatal(err)
+		}
+
+		// messages 2 and 3 are lost in channel buffer
+		cancel()
+		waitDeregister(t, tc.name)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+
+		act, err = actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(mem.Store),
+			actor.WithDurableMailbox(0),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 2; idx <= 3; idx++ {
+			env := receiveEnvelope(t, act)
+
+			var msg string
+			if err := env.Decode(&msg); err != nil {
+				t.Fatal(err)
+			}
+
+			if msg != fmt.Sprintf("message %d", idx) || env.Attempt != 2 {
+				t.Errorf("expecting: message %d attempt 2, receiving: %s %d", idx, msg, env.Attempt)
+			}
+
+			env.Ack()
+		}
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) {
+				for {
+					select {
+					case <-act.Done():
+						return
+					case msg := <-act.Receive():
+						msg.(*actor.Envelope).Nack("poison")
+					}
+				}
+			},
+			tc.backup,
+			actor.WithBackup(actor.NewMemoryBackup().Store),
+			actor.WithDurableMailbox(3),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if err := act.Send("poison message"); err != nil {
+			t.Fatal(err)
+		}
+
+		timeout := time.After(5 * time.Second)
+
+	wait:
+		for {
+			select {
+			case ev := <-sub.C:
+				dl, ok := ev.(actor.DeadLetter)
+				if !ok || dl.Actor != tc.name {
+					continue
+				}
+
+				if dl.Envelope.Attempt != 3 || dl.Reason != "poison" {
+					t.Errorf("expecting: attempt 3 poison, receiving: %d %s", dl.Envelope.Attempt, dl.Reason)
+				}
+
+				break wait
+			case <-timeout:
+				t.Fatal(actorTimeoutErr)
+			}
+		}
+
+		dead, err := act.DeadLetters()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dead) != 1 || dead[0].Message != "poison message" {
+			t.Errorf("expecting: 1 dead letter, receiving: %v", dead)
+		}
+	}
+}
+
+func TestDurableMailboxUnsupported(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, -1) {
+		_, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithDurableMailbox(0),
+		)
+		if err != actor.ErrBackupDisabled {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrBackupDisabled, err)
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// MemoryBackup keeps backed up messages, snapshots, durable mailboxes and
+	// dedup message ids and outboxes in memory
+	//
+	// MemoryBackup is meant for tests, content is lost once process exits.
+	// Pass MemoryBackup.Store to WithBackup or SetBackup.
+	MemoryBackup struct {
+		rwLock    sync.RWMutex
+		order     []string                        // uuid in creation order
+		instances map[string]*memoryInstance      // uuid -> instance
+		snapshots map[string][]memorySnapshot     // name -> snapshots
+		mailboxes map[string][]*memoryMail        // name -> mailbox in enqueue order
+		seen      map[string]map[string]time.Time // name -> message id -> time
+		outboxes  map[string][]OutboxEntry        // name -> undelivered messages
+	}
+
+	memoryInstance struct {
+		name      string
+		uuid      string
+		startTime time.Time
+		endTime   time.Time
+		records   []BackupRecord
+	}
+
+	memorySnapshot struct {
+		codec string
+		state []byte
+	}
+
+	memoryMail struct {
+		entry MailboxEntry
+		owner string // uuid of actor instance delivers the message
+		dead  bool
+	}
+
+	// memoryStore is the BackupStore of an actor instance
+	memoryStore struct {
+		backup *MemoryBackup
+		name   string
+		uuid   string
+	}
+)
+
+// NewMemoryBackup returns empty MemoryBackup
+func NewMemoryBackup() *MemoryBackup {
+	return &MemoryBackup{
+		instances: make(map[string]*memoryInstance),
+		snapshots: make(map[string][]memorySnapshot),
+		mailboxes: make(map[string][]*memoryMail),
+		seen:      make(map[string]map[string]time.Time),
+		outboxes:  make(map[string][]OutboxEntry),
+	}
+}
+
+// Store is the BackupFactory creates in memory BackupStore
+//
+// rotate is ignored, messages are never rotated
+func (m *MemoryBackup) Store(
+	ctx context.Context,
+	name, uuid string,
+	rotate int,
+) (BackupStore, error) {
+	defer m.rwLock.Unlock()
+	m.rwLock.Lock()
+
+	m.order = append(m.order, uuid)
+	m.instances[uuid] = &memoryInstance{name: name, uuid: uuid}
+
+	return &memoryStore{m, name, uuid}, nil
+}
+
+// Records returns messages backed up by actor instances with the name
+//
+// actor instances are ordered by creation
+//
+// uuid: actor uuid, empty string returns all actor instances with the name
+func (m *MemoryBackup) Records(name, uuid string) []BackupRecord {
+	defer m.rwLock.RUnlock()
+	m.rwLock.RLock()
+
+	var records []BackupRecord
+
+	for _, id := range m.order {
+		inst := m.instances[id]
+		if inst.name == name && (uuid == "" || inst.uuid == uuid) {
+			records = append(records, inst.records...)
+		}
+	}
+
+	return records
+}
+
+// Stopped reports whether actor instance recorded its end time
+func (m *MemoryBackup) Stopped(uuid string) bool {
+	defer m.rwLock.RUnlock()
+	m.rwLock.RLock()
+
+	inst, ok := m.instances[uuid]
+
+	return ok && !inst.endTime.IsZero()
+}
+
+func (s *memoryStore) Start(startTime time.Time) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	s.backup.instances[s.uuid].startTime = startTime
+
+	return nil
+}
+
+func (s *memoryStore) Insert(msg string) error {
+	return s.InsertBatch([]string{msg})
+}
+
+func (s *memoryStore) InsertBatch(msgs []string) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	inst := s.backup.instances[s.uuid]
+	now := time.Now()
+
+	for _, msg := range msgs {
+		inst.records = append(inst.records, BackupRecord{
+			UUID:    s.uuid,
+			Seq:     int64(len(inst.records) + 1),
+			Time:    now,
+			Message: msg,
+		})
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Stop(endTime time.Time) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	s.backup.instances[s.uuid].endTime = endTime
+
+	return nil
+}
+
+func (s *memoryStore) Close() {}
+
+func (s *memoryStore) SaveSnapshot(codec string, state []byte, keep int) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	s.saveSnapshot(codec, state, keep)
+
+	return nil
+}
+
+func (s *memoryStore) saveSnapshot(codec string, state []byte, keep int) {
+	snapshots := append(
+		s.backup.snapshots[s.name],
+		memorySnapshot{codec, append([]byte(nil), state...)},
+	)
+
+	if keep > 0 && len(snapshots) > keep {
+		snapshots = snapshots[len(snapshots)-keep:]
+	}
+
+	s.backup.snapshots[s.name] = snapshots
+}
+
+func (s *memoryStore) LoadLatestSnapshot() (string, []byte, error) {
+	defer s.backup.rwLock.RUnlock()
+	s.backup.rwLock.RLock()
+
+	snapshots := s.backup.snapshots[s.name]
+	if len(snapshots) == 0 {
+		return "", nil, ErrSnapshotNotFound
+	}
+
+	latest := snapshots[len(snapshots)-1]
+
+	return latest.codec, append([]byte(nil), latest.state...), nil
+}
+
+func (s *memoryStore) Enqueue(id, codec string, payload []byte) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	s.backup.mailboxes[s.name] = append(
+		s.backup.mailboxes[s.name],
+		&memoryMail{
+			entry: MailboxEntry{
+				ID:       id,
+				Time:     time.Now(),
+				Codec:    codec,
+				Payload:  append([]byte(nil), payload...),
+				Attempts: 1,
+			},
+			owner: s.uuid,
+		},
+	)
+
+	return nil
+}
+
+func (s *memoryStore) Ack(id string) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	mails := s.backup.mailboxes[s.name]
+
+	for idx, m := range mails {
+		if m.entry.ID == id && !m.dead {
+			s.backup.mailboxes[s.name] = append(mails[:idx:idx], mails[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) Attempt(id string) (int, error) {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	m := s.find(id)
+	if m == nil {
+		return 0, ErrRetrieveMessage
+	}
+
+	m.entry.Attempts++
+
+	return m.entry.Attempts, nil
+}
+
+func (s *memoryStore) DeadLetter(id, reason string) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	m := s.find(id)
+	if m == nil {
+		return ErrRetrieveMessage
+	}
+
+	m.dead = true
+	m.entry.Reason = reason
+
+	return nil
+}
+
+func (s *memoryStore) Recover() ([]MailboxEntry, error) {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	var entries []MailboxEntry
+
+	for _, m := range s.backup.mailboxes[s.name] {
+		if !m.dead && m.owner != s.uuid {
+			m.owner = s.uuid
+			entries = append(entries, m.entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *memoryStore) DeadLetters() ([]MailboxEntry, error) {
+	defer s.backup.rwLock.RUnlock()
+	s.backup.rwLock.RLock()
+
+	var entries []MailboxEntry
+
+	for _, m := range s.backup.mailboxes[s.name] {
+		if m.dead {
+			entries = append(entries, m.entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *memoryStore) find(id string) *memoryMail {
+	for _, m := range s.backup.mailboxes[s.name] {
+		if m.entry.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) MarkSeen(id string, t time.Time) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	seen, ok := s.backup.seen[s.name]
+	if !ok {
+		seen = make(map[string]time.Time)
+		s.backup.seen[s.name] = seen
+	}
+
+	seen[id] = t
+
+	return nil
+}
+
+func (s *memoryStore) Seen(since time.Time) (map[string]time.Time, error) {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	ids := make(map[string]time.Time)
+
+	for id, t := range s.backup.seen[s.name] {
+		if t.Before(since) {
+			delete(s.backup.seen[s.name], id)
+			continue
+		}
+
+		ids[id] = t
+	}
+
+	return ids, nil
+}
+
+func (s *memoryStore) SaveOutbox(
+	codec string,
+	state []byte,
+	keep int,
+	out []OutboxEntry,
+) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	if state != nil {
+		s.saveSnapshot(codec, state, keep)
+	}
+
+	now := time.Now()
+
+	for _, o := range out {
+		o.Time = now
+		o.Payload = append([]byte(nil), o.Payload...)
+		s.backup.outboxes[s.name] = append(s.backup.outboxes[s.name], o)
+	}
+
+	return nil
+}
+
+// ClaimOutbox is a no-op, outboxes are shared by actor instances with the
+// same name
+func (s *memoryStore) ClaimOutbox() error {
+	return nil
+}
+
+func (s *memoryStore) PendingOutbox() ([]OutboxEntry, error) {
+	defer s.backup.rwLock.RUnlock()
+	s.backup.rwLock.RLock()
+
+	return append([]OutboxEntry(nil), s.backup.outboxes[s.name]...), nil
+}
+
+func (s *memoryStore) OutboxAttempt(id string) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	for idx := range s.backup.outboxes[s.name] {
+		if s.backup.outboxes[s.name][idx].ID == id {
+			s.backup.outboxes[s.name][idx].Attempts++
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryStore) OutboxDone(id string) error {
+	defer s.backup.rwLock.Unlock()
+	s.backup.rwLock.Lock()
+
+	out := s.backup.outboxes[s.name]
+
+	for idx := range out {
+		if out[idx].ID == id {
+			s.backup.outboxes[s.name] = append(out[:idx:idx], out[idx+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,479 @@
+package actor
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	idb "github.com/vsdmars/actor/internal/db"
+)
+
+// metric names, labelled by actor name
+const (
+	// counter, messages delivered into mailbox
+	MetricSent = "actor_messages_sent_total"
+	// counter, messages taken from mailbox, counted by the receive loop of
+	// actors created by Spawn or NewBehaviorActor, derived from sent messages
+	// and mailbox depth by Send, ReceiveBatch, Envelope.Handle, idle update
+	// and actor end for other actors
+	MetricReceived = "actor_messages_received_total"
+	// gauge, messages waiting in mailbox, updated on send
+	MetricMailboxDepth = "actor_mailbox_depth"
+	// gauge, mailbox buffer size
+	MetricMailboxCapacity = "actor_mailbox_capacity"
+	// histogram, handler processing time, measured by the receive loop of
+	// actors created by Spawn or NewBehaviorActor, by Envelope.Handle for
+	// other actors
+	MetricHandleLatency = "actor_handler_latency_seconds"
+	// counter, handler panics
+	MetricPanics = "actor_panics_total"
+	// counter, instances started with a name started before in this process
+	// while metrics are enabled, or behaviors restarted by PreRestarter
+	MetricRestarts = "actor_restarts_total"
+	// gauge, actor idle time
+	MetricIdle = "actor_idle_seconds"
+	// histogram, backup insert time, per batch if WithBatchBackup
+	MetricBackupLatency = "actor_backup_insert_latency_seconds"
+	// counter, failed backup inserts
+	MetricBackupErrors = "actor_backup_errors_total"
+	// counter, sqlite backup rotations
+	MetricBackupRotations = "actor_backup_rotations_total"
+)
+
+// DefaultBuckets are histogram buckets in seconds used by MetricsRegistry
+var DefaultBuckets = []float64{
+	.0001, .0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+const (
+	metricCounter   = "counter"
+	metricGauge     = "gauge"
+	metricHistogram = "histogram"
+)
+
+type metricInfo struct {
+	kind string
+	help string
+}
+
+var metricInfos = map[string]metricInfo{
+	MetricSent:            {metricCounter, "Messages delivered into actor mailbox."},
+	MetricReceived:        {metricCounter, "Messages taken from actor mailbox."},
+	MetricMailboxDepth:    {metricGauge, "Messages waiting in actor mailbox."},
+	MetricMailboxCapacity: {metricGauge, "Actor mailbox buffer size."},
+	MetricHandleLatency:   {metricHistogram, "Actor handler processing time."},
+	MetricPanics:          {metricCounter, "Actor handler panics."},
+	MetricRestarts:        {metricCounter, "Actor instances restarted by name."},
+	MetricIdle:            {metricGauge, "Actor idle time."},
+	MetricBackupLatency:   {metricHistogram, "Actor backup insert time."},
+	MetricBackupErrors:    {metricCounter, "Failed actor backup inserts."},
+	MetricBackupRotations: {metricCounter, "Actor sqlite backup rotations."},
+}
+
+type (
+	// Metrics records actor runtime metrics
+	//
+	// Metrics is called on the message path, it must not block.
+	Metrics interface {
+		// Count adds delta to counter
+		Count(name, actor string, delta float64)
+		// Gauge sets gauge to value
+		Gauge(name, actor string, value float64)
+		// Observe records histogram sample
+		Observe(name, actor string, value float64)
+	}
+
+	// MetricsRegistry keeps metrics in memory, serves them in Prometheus
+	// text exposition format
+	//
+	// series are updated by atomics, recording does not lock once series
+	// exists.
+	MetricsRegistry struct {
+		buckets  []float64
+		families sync.Map // name -> *sync.Map actor -> *metricSeries
+	}
+
+	// metricSeries holds float64 values as bits, updated atomically
+	metricSeries struct {
+		value   uint64   // counter, gauge
+		buckets []uint64 // histogram, cumulative counts per bucket
+		sum     uint64
+		count   uint64
+	}
+
+	// metricsHolder holds Metrics in atomic.Value, nil: disabled
+	metricsHolder struct {
+		m Metrics
+	}
+
+	// ExpvarMetrics publishes metrics into expvar.Map
+	//
+	// counters and gauges are published as name -> actor -> value,
+	// histograms as name_count and name_sum.
+	ExpvarMetrics struct {
+		lock sync.Mutex
+		m    *expvar.Map
+	}
+)
+
+// actor names remembered for MetricRestarts, oldest are forgotten
+const maxStartedNames = 10000
+
+var (
+	// metricsHolder, loaded on every send
+	metrics atomic.Value
+
+	// actor names started in this process while metrics are enabled
+	startedNames = struct {
+		lock  sync.Mutex
+		names map[string]struct{}
+		order []string // oldest first
+	}{names: make(map[string]struct{})}
+)
+
+func init() {
+	idb.SetRotateHook(func(name, uuid string) {
+		if m := getMetrics(); m != nil {
+			m.Count(MetricBackupRotations, name, 1)
+		}
+	})
+}
+
+// SetMetrics enables recording runtime metrics of actors into m
+//
+// nil disables metrics.
+func SetMetrics(m Metrics) {
+	metrics.Store(metricsHolder{m})
+}
+
+func getMetrics() Metrics {
+	h, _ := metrics.Load().(metricsHolder)
+	return h.m
+}
+
+// recordStart records mailbox capacity and restart of actor
+func (actor *localActor) recordStart() {
+	m := getMetrics()
+	if m == nil {
+		return
+	}
+
+	m.Gauge(MetricMailboxCapacity, actor.name, float64(actor.mailboxCap()))
+
+	if started(actor.name) {
+		m.Count(MetricRestarts, actor.name, 1)
+	}
+}
+
+// recordReceive counts message taken from mailbox by receive loop, returns
+// the time handler starts, zero if metrics are disabled
+func (actor *localActor) recordReceive(m Metrics) time.Time {
+	if m == nil {
+		return time.Time{}
+	}
+
+	m.Count(MetricReceived, actor.name, 1)
+
+	return time.Now()
+}
+
+// recordHandled records latency of handler started at start by receive loop
+func (actor *localActor) recordHandled(m Metrics, start time.Time) {
+	if m != nil {
+		m.Observe(MetricHandleLatency, actor.name, time.Since(start).Seconds())
+	}
+}
+
+// recordReceived counts messages taken from mailbox by handler reads it
+// directly, derived from delivered messages and mailbox depth
+func (actor *localActor) recordReceived(m Metrics) {
+	if actor.measured {
+		return
+	}
+
+	// delivered is loaded before mailbox depth, thus messages delivered in
+	// between are not counted as received
+	received := int64(atomic.LoadUint64(&actor.delivered)) - int64(actor.mailboxLen())
+
+	for {
+		reported := atomic.LoadUint64(&actor.received)
+		if received <= int64(reported) {
+			return
+		}
+
+		if atomic.CompareAndSwapUint64(&actor.received, reported, uint64(received)) {
+			m.Count(MetricReceived, actor.name, float64(uint64(received)-reported))
+			return
+		}
+	}
+}
+
+// started reports whether an actor with the name is started before,
+// remembers the name otherwise
+func started(name string) bool {
+	defer startedNames.lock.Unlock()
+	startedNames.lock.Lock()
+
+	if _, ok := startedNames.names[name]; ok {
+		return true
+	}
+
+	startedNames.names[name] = struct{}{}
+	startedNames.order = append(startedNames.order, name)
+
+	if len(startedNames.order) > maxStartedNames {
+		delete(startedNames.names, startedNames.order[0])
+		startedNames.order[0] = ""
+		startedNames.order = startedNames.order[1:]
+	}
+
+	return false
+}
+
+// NewMetricsRegistry returns empty MetricsRegistry
+//
+// buckets: histogram upper bounds in seconds, empty: DefaultBuckets
+func NewMetricsRegistry(buckets ...float64) *MetricsRegistry {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+
+	return &MetricsRegistry{buckets: b}
+}
+
+// series returns series of metric name and actor, created if absent
+//
+// histogram: series records histogram samples
+func (r *MetricsRegistry) series(name, actor string, histogram bool) *metricSeries {
+	f, ok := r.families.Load(name)
+	if !ok {
+		f, _ = r.families.LoadOrStore(name, new(sync.Map))
+	}
+	family := f.(*sync.Map)
+
+	s, ok := family.Load(actor)
+	if !ok {
+		series := &metricSeries{}
+		if histogram {
+			series.buckets = make([]uint64, len(r.buckets))
+		}
+
+		s, _ = family.LoadOrStore(actor, series)
+	}
+
+	return s.(*metricSeries)
+}
+
+// Count adds delta to counter
+func (r *MetricsRegistry) Count(name, actor string, delta float64) {
+	addFloat(&r.series(name, actor, false).value, delta)
+}
+
+// Gauge sets gauge to value
+func (r *MetricsRegistry) Gauge(name, actor string, value float64) {
+	atomic.StoreUint64(&r.series(name, actor, false).value, math.Float64bits(value))
+}
+
+// Observe records histogram sample
+func (r *MetricsRegistry) Observe(name, actor string, value float64) {
+	s := r.series(name, actor, true)
+
+	for idx, le := range r.buckets {
+		if idx < len(s.buckets) && value <= le {
+			atomic.AddUint64(&s.buckets[idx], 1)
+		}
+	}
+
+	addFloat(&s.sum, value)
+	atomic.AddUint64(&s.count, 1)
+}
+
+// Value returns value of counter or gauge, 0 if absent
+func (r *MetricsRegistry) Value(name, actor string) float64 {
+	f, ok := r.families.Load(name)
+	if !ok {
+		return 0
+	}
+
+	s, ok := f.(*sync.Map).Load(actor)
+	if !ok {
+		return 0
+	}
+
+	return loadFloat(&s.(*metricSeries).value)
+}
+
+// WriteText writes metrics in Prometheus text exposition format
+func (r *MetricsRegistry) WriteText(w io.Writer) error {
+	families := make(map[string]map[string]*metricSeries)
+	names := make([]string, 0)
+
+	r.families.Range(func(k, f interface{}) bool {
+		name := k.(string)
+		names = append(names, name)
+		families[name] = make(map[string]*metricSeries)
+
+		f.(*sync.Map).Range(func(actor, s interface{}) bool {
+			families[name][actor.(string)] = s.(*metricSeries)
+			return true
+		})
+
+		return true
+	})
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	for _, name := range names {
+		family := families[name]
+
+		info, ok := metricInfos[name]
+		if !ok {
+			info = metricInfo{kind: metricGauge}
+			if isHistogram(family) {
+				info.kind = metricHistogram
+			}
+		}
+
+		if info.help != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, info.help)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, info.kind)
+
+		actors := make([]string, 0, len(family))
+		for actor := range family {
+			actors = append(actors, actor)
+		}
+		sort.Strings(actors)
+
+		for _, actor := range actors {
+			s := family[actor]
+			label := fmt.Sprintf(`actor="%s"`, escapeLabel(actor))
+
+			if info.kind != metricHistogram {
+				fmt.Fprintf(&b, "%s{%s} %s\n", name, label, formatFloat(loadFloat(&s.value)))
+				continue
+			}
+
+			for idx, le := range r.buckets {
+				var cnt uint64
+				if idx < len(s.buckets) {
+					cnt = atomic.LoadUint64(&s.buckets[idx])
+				}
+
+				fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d\n",
+					name, label, formatFloat(le), cnt)
+			}
+
+			count := atomic.LoadUint64(&s.count)
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, label, count)
+			fmt.Fprintf(&b, "%s_sum{%s} %s\n", name, label, formatFloat(loadFloat(&s.sum)))
+			fmt.Fprintf(&b, "%s_count{%s} %d\n", name, label, count)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// isHistogram reports whether metric family is recorded by Observe
+func isHistogram(family map[string]*metricSeries) bool {
+	for _, s := range family {
+		if s.buckets != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addFloat adds delta to float64 stored as bits at addr
+func addFloat(addr *uint64, delta float64) {
+	for {
+		old := atomic.LoadUint64(addr)
+		v := math.Float64bits(math.Float64frombits(old) + delta)
+
+		if atomic.CompareAndSwapUint64(addr, old, v) {
+			return
+		}
+	}
+}
+
+// loadFloat returns float64 stored as bits at addr
+func loadFloat(addr *uint64) float64 {
+	return math.Float64frombits(atomic.LoadUint64(addr))
+}
+
+// ServeHTTP serves metrics in Prometheus text exposition format
+func (r *MetricsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+// NewExpvarMetrics returns ExpvarMetrics publishes into m
+//
+// e.g. NewExpvarMetrics(expvar.NewMap("actor"))
+func NewExpvarMetrics(m *expvar.Map) *ExpvarMetrics {
+	return &ExpvarMetrics{m: m}
+}
+
+// value returns expvar value of metric name and actor, created if absent
+func (e *ExpvarMetrics) value(name, actor string) *expvar.Float {
+	if family, ok := e.m.Get(name).(*expvar.Map); ok {
+		if v, ok := family.Get(actor).(*expvar.Float); ok {
+			return v
+		}
+	}
+
+	defer e.lock.Unlock()
+	e.lock.Lock()
+
+	family, ok := e.m.Get(name).(*expvar.Map)
+	if !ok {
+		family = new(expvar.Map).Init()
+		e.m.Set(name, family)
+	}
+
+	v, ok := family.Get(actor).(*expvar.Float)
+	if !ok {
+		v = new(expvar.Float)
+		family.Set(actor, v)
+	}
+
+	return v
+}
+
+// Count adds delta to counter
+func (e *ExpvarMetrics) Count(name, actor string, delta float64) {
+	e.value(name, actor).Add(delta)
+}
+
+// Gauge sets gauge to value
+func (e *ExpvarMetrics) Gauge(name, actor string, value float64) {
+	e.value(name, actor).Set(value)
+}
+
+// Observe records histogram sample as name_count and name_sum
+func (e *ExpvarMetrics) Observe(name, actor string, value float64) {
+	e.value(name+"_count", actor).Add(1)
+	e.value(name+"_sum", actor).Add(value)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
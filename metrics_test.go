@@ -0,0 +1,269 @@
+package actor_test
+
+import (
+	"context"
+	"expvar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	reg := actor.NewMetricsRegistry()
+	actor.SetMetrics(reg)
+	defer actor.SetMetrics(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+
+	for _, tc := range createTestCase(1, 4, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) {
+				for idx := 0; idx < 3; idx++ {
+					env := (<-act.Receive()).(*actor.Envelope)
+					_, end := env.Handle()
+					act.Backup("handled")
+					end()
+				}
+				close(done)
+				<-act.Done()
+			},
+			tc.backup,
+			actor.WithBackup(actor.NewMemoryBackup().Store),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		for idx := 0; idx < 3; idx++ {
+			if err := act.Send(actor.NewEnvelope(idx)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+
+		for name, expect := range map[string]float64{
+			actor.MetricSent:            3,
+			actor.MetricReceived:        3,
+			actor.MetricMailboxCapacity: 4,
+			actor.MetricBackupErrors:    0,
+		} {
+			if v := reg.Value(name, tc.name); v != expect {
+				t.Fatalf("%s expecting: %v, receiving: %v", name, expect, v)
+			}
+		}
+
+		rec := httptest.NewRecorder()
+		reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Fatalf("expecting: text/plain, receiving: %s", ct)
+		}
+
+		body := rec.Body.String()
+		for _, line := range []string{
+			"# TYPE actor_messages_sent_total counter",
+			`actor_messages_sent_total{actor="` + tc.name + `"} 3`,
+			"# TYPE actor_handler_latency_seconds histogram",
+			`actor_handler_latency_seconds_bucket{actor="` + tc.name + `",le="+Inf"} 3`,
+			`actor_handler_latency_seconds_count{actor="` + tc.name + `"} 3`,
+			`actor_backup_insert_latency_seconds_count{actor="` + tc.name + `"} 3`,
+		} {
+			if !strings.Contains(body, line+"\n") {
+				t.Fatalf("expecting: %q in\n%s", line, body)
+			}
+		}
+	}
+}
+
+func TestMetricsReceiveLoop(t *testing.T) {
+	reg := actor.NewMetricsRegistry()
+	actor.SetMetrics(reg)
+	defer actor.SetMetrics(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(3, 4, -1)
+	received := make(chan struct{}, 9)
+	release := make(chan struct{})
+	defer close(release)
+
+	// the last message blocks handler, thus latency of previous messages is
+	// recorded
+	handle := func(msg interface{}) {
+		received <- struct{}{}
+
+		if msg == 3 {
+			<-release
+		}
+	}
+
+	spawned, err := actor.Spawn(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(ctx context.Context, msg interface{}) { handle(msg) },
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	behavior, err := actor.NewBehaviorActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		actor.BehaviorFunc(func(ctx actor.ActorContext, msg interface{}) {
+			handle(msg)
+		}),
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	// reads mailbox directly without Envelope.Handle
+	plain, err := actor.NewActor(
+		ctx,
+		cases[2].name,
+		cases[2].buffer,
+		func(act actor.Actor) {
+			for {
+				select {
+				case <-act.Receive():
+					received <- struct{}{}
+				case <-act.Done():
+					return
+				}
+			}
+		},
+		cases[2].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	actors := []actor.Actor{spawned, behavior, plain}
+
+	send := func(msgs ...int) {
+		for _, act := range actors {
+			for _, msg := range msgs {
+				if err := act.Send(msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		for idx := 0; idx < len(actors)*len(msgs); idx++ {
+			select {
+			case <-received:
+			case <-time.After(5 * time.Second):
+				t.Fatal(actorTimeoutErr)
+			}
+		}
+	}
+
+	// plain actor's received messages are counted by the next send
+	send(0, 1, 2)
+	send(3)
+
+	for act, expect := range map[actor.Actor]float64{
+		spawned:  4,
+		behavior: 4,
+		plain:    3,
+	} {
+		if v := reg.Value(actor.MetricReceived, act.Name()); v < expect {
+			t.Fatalf("%s expecting: %v received, receiving: %v", act.Name(), expect, v)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, act := range []actor.Actor{spawned, behavior} {
+		line := `actor_handler_latency_seconds_count{actor="` + act.Name() + `"} 3`
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("expecting: %q in\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsRestartAndPanic(t *testing.T) {
+	reg := actor.NewMetricsRegistry()
+	actor.SetMetrics(reg)
+	defer actor.SetMetrics(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc := createTestCase(1, 0, -1)[0]
+
+	for idx := 0; idx < 2; idx++ {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) {
+				<-act.Receive()
+				panic("crash")
+			},
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if err := act.Send("crash"); err != nil {
+			t.Fatal(err)
+		}
+
+		waitDeregister(t, tc.name)
+	}
+
+	// panic is reported after deregistration
+	for idx := 0; idx < 100 && reg.Value(actor.MetricPanics, tc.name) < 2; idx++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if v := reg.Value(actor.MetricPanics, tc.name); v != 2 {
+		t.Fatalf("expecting: 2 panics, receiving: %v", v)
+	}
+
+	if v := reg.Value(actor.MetricRestarts, tc.name); v != 1 {
+		t.Fatalf("expecting: 1 restart, receiving: %v", v)
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	vars := new(expvar.Map).Init()
+	m := actor.NewExpvarMetrics(vars)
+
+	m.Count(actor.MetricSent, "a", 1)
+	m.Count(actor.MetricSent, "a", 2)
+	m.Gauge(actor.MetricMailboxDepth, "a", 5)
+	m.Observe(actor.MetricHandleLatency, "a", 0.5)
+
+	expect := `{"actor_handler_latency_seconds_count": {"a": 1}, ` +
+		`"actor_handler_latency_seconds_sum": {"a": 0.5}, ` +
+		`"actor_mailbox_depth": {"a": 5}, ` +
+		`"actor_messages_sent_total": {"a": 3}}`
+
+	if v := vars.String(); v != expect {
+		t.Fatalf("expecting: %s, receiving: %s", expect, v)
+	}
+}
@@ -0,0 +1,28 @@
+// +build !database
+
+package actor_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestNoSqlite(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		_, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != actor.ErrNoSqlite {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrNoSqlite, err)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package actor
+
+import "time"
+
+const (
+	// default number of snapshots preserved per actor
+	defaultSnapshotKeep = 3
+	// default number of messages stashed per behavior actor
+	defaultStashCapacity = 1000
+)
+
+type (
+	// Option configures the actor created by NewActor
+	Option func(*options)
+
+	options struct {
+		backup       BackupFactory  // backup store factory
+		batched      bool           // write backup in batch
+		batchSize    int            // number of messages per batch
+		batchLatency time.Duration  // latency bound of queued message
+		codec        Codec          // snapshot codec
+		snapshotKeep int            // number of snapshots preserved
+		encoding     BackupEncoding // backed up message encoding
+		durable      bool           // persist messages before delivery
+		maxAttempts  int            // delivery attempts before dead letter
+		dedup        *DedupConfig   // nil: no deduplication
+		outbox       *RelayConfig   // nil: no outbox
+		parent       Actor          // supervising actor, nil: root
+		logger       Logger         // nil: service logger
+		ring         bool           // ring buffer mailbox
+		dispatcher   *Dispatcher    // nil: DefaultDispatcher, used by Spawn
+		receiveFn    ReceiveFunc    // set by Spawn, nil: goroutine per actor
+		stashCap     int            // messages stashed by behavior actor
+		measured     bool           // receive loop records received metrics
+	}
+)
+
+func newOptions(opts []Option) options {
+	o := options{
+		codec:        JSONCodec{},
+		snapshotKeep: defaultSnapshotKeep,
+		stashCap:     defaultStashCapacity,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// WithBackup sets the BackupFactory creates actor's BackupStore
+//
+// default: BackupFactory set by SetBackup
+func WithBackup(f BackupFactory) Option {
+	return func(o *options) {
+		o.backup = f
+	}
+}
+
+// WithBatchBackup queues backed up messages and writes them in batch
+//
+// A batch is written once size messages are queued or the oldest queued
+// message waits for latency. Queued messages are written on actor stop,
+// call actor's Flush to wait until queued messages are written.
+//
+// size: <= 0: default 256 messages
+//
+// latency: <= 0: default 10 milliseconds
+func WithBatchBackup(size int, latency time.Duration) Option {
+	return func(o *options) {
+		o.batched = true
+		o.batchSize = size
+		o.batchLatency = latency
+	}
+}
+
+// WithCodec sets the codec used for serializing actor's snapshot
+//
+// default: JSONCodec
+func WithCodec(c Codec) Option {
+	return func(o *options) {
+		if c != nil {
+			o.codec = c
+		}
+	}
+}
+
+// WithSnapshotRetention sets number of latest snapshots preserved
+//
+// keep: <= 0: preserve all snapshots, > 0: preserve number of latest snapshots
+func WithSnapshotRetention(keep int) Option {
+	return func(o *options) {
+		o.snapshotKeep = keep
+	}
+}
+
+// WithBackupEncoding compresses and/or encrypts backed up messages
+//
+// default: plaintext
+func WithBackupEncoding(e BackupEncoding) Option {
+	return func(o *options) {
+		o.encoding = e
+	}
+}
+
+// WithDurableMailbox stores each sent message into actor's BackupStore
+// before delivery
+//
+// Handler receives *Envelope and calls its Ack once the message is processed.
+// Unacknowledged messages are redelivered to the next actor instance with the
+// same name, e.g. after process crash or Cleanup. Actor's codec serializes
+// messages. BackupStore must implement MailboxStore, and backup must be
+// enabled.
+//
+// maxAttempts: <= 0: unlimited, > 0: message is moved into dead letter queue
+// once its delivery attempts reach maxAttempts
+func WithDurableMailbox(maxAttempts int) Option {
+	return func(o *options) {
+		o.durable = true
+		o.maxAttempts = maxAttempts
+	}
+}
+
+// WithDedup drops messages sent with a message id seen within the window
+//
+// Message id is carried by *Envelope, created by NewEnvelope or with a user
+// supplied ID. Messages sent without envelope are never deduplicated.
+// Duplicated sends return nil, thus retries are idempotent. Message id is
+// seen once the message is delivered, a send while the same id is in flight
+// waits for its result, and is delivered if the in-flight send fails.
+func WithDedup(cfg DedupConfig) Option {
+	return func(o *options) {
+		o.dedup = &cfg
+	}
+}
+
+// WithOutbox enables Commit, records outgoing messages along with actor's
+// state, and delivers them by outbox relay
+//
+// BackupStore must implement OutboxStore, and backup must be enabled.
+func WithOutbox(cfg RelayConfig) Option {
+	return func(o *options) {
+		o.outbox = &cfg
+	}
+}
+
+// WithParent sets the supervising actor, shown in the supervisor tree of
+// Snapshot
+//
+// Child actor is cancelled along with parent if created with parent's
+// context, e.g. the context returned by parent's Envelope.Context.
+func WithParent(parent Actor) Option {
+	return func(o *options) {
+		o.parent = parent
+	}
+}
+
+// WithLogger sets the logger used by actor
+//
+// default: logger set by SetLogger
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithRingMailbox replaces actor's channel mailbox with RingMailbox
+//
+// NewActor's buffer sets the ring capacity, rounded up to power of two.
+// Handler receives messages in batch by ReceiveBatch, Receive panics since
+// there is no channel to receive from.
+func WithRingMailbox() Option {
+	return func(o *options) {
+		o.ring = true
+	}
+}
+
+// WithDispatcher sets the Dispatcher schedules actor created by Spawn
+//
+// default: DefaultDispatcher
+func WithDispatcher(d *Dispatcher) Option {
+	return func(o *options) {
+		o.dispatcher = d
+	}
+}
+
+// WithStashCapacity sets the number of messages a behavior actor created by
+// NewBehaviorActor is able to stash, Stash returns ErrStashFull beyond it
+//
+// default: 1000, <= 0: stashing disabled
+func WithStashCapacity(n int) Option {
+	return func(o *options) {
+		o.stashCap = n
+	}
+}
@@ -0,0 +1,376 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	idb "github.com/vsdmars/actor/internal/db"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// default period relay retries undelivered messages
+	defaultRelayInterval = time.Second
+	// default backoff after the first failed delivery
+	defaultRelayMinBackoff = 100 * time.Millisecond
+	// default upper bound of backoff
+	defaultRelayMaxBackoff = 30 * time.Second
+)
+
+type (
+	// OutboxEntry is an outgoing message stored in outbox
+	OutboxEntry = idb.Outbox
+
+	// OutboxStore is implemented by BackupStore supports transactional outbox
+	OutboxStore interface {
+		// SaveOutbox stores serialized state as snapshot and outgoing
+		// messages in a single transaction, state is nil if only outgoing
+		// messages are stored
+		SaveOutbox(codec string, state []byte, keep int, out []OutboxEntry) error
+		// ClaimOutbox claims undelivered outgoing messages left by
+		// previous actor instances with the same name, called once before
+		// relay starts
+		ClaimOutbox() error
+		// PendingOutbox returns undelivered outgoing messages in record
+		// order, including the claimed ones
+		PendingOutbox() ([]OutboxEntry, error)
+		// OutboxAttempt records a failed delivery attempt
+		OutboxAttempt(id string) error
+		// OutboxDone removes delivered outgoing message
+		OutboxDone(id string) error
+	}
+
+	// OutboxMessage is an outgoing message recorded by Commit
+	OutboxMessage struct {
+		Target  string      // receiving actor name
+		Message interface{} // serialized by sending actor's codec
+	}
+
+	// DeliverFunc delivers outgoing message to target
+	DeliverFunc func(target string, env *Envelope) error
+
+	// RelayConfig configures outbox relay
+	RelayConfig struct {
+		// Interval is the period retrying undelivered messages,
+		// <= 0: 1 second
+		Interval time.Duration
+		// MinBackoff is the backoff after the first failed delivery, doubled
+		// per failed delivery, <= 0: 100 milliseconds
+		MinBackoff time.Duration
+		// MaxBackoff is the upper bound of backoff, <= 0: 30 seconds
+		MaxBackoff time.Duration
+		// SendTimeout bounds the wait for a full mailbox of target actor by
+		// default Deliver, timed out delivery is a failed attempt,
+		// <= 0: Interval
+		SendTimeout time.Duration
+		// Deliver delivers outgoing message, e.g. to an external system,
+		// nil: Send to the registered actor named by target
+		Deliver DeliverFunc
+	}
+
+	// relay delivers outgoing messages recorded in outbox
+	relay struct {
+		actor *localActor
+		store OutboxStore
+		cfg   RelayConfig
+		wake  chan struct{}
+		lock  sync.Mutex
+		sent  map[string]interface{} // id -> message recorded by this instance
+		next  map[string]time.Time   // id -> next delivery attempt
+	}
+)
+
+func newRelay(actor *localActor, store OutboxStore, cfg RelayConfig) *relay {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultRelayInterval
+	}
+
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = defaultRelayMinBackoff
+	}
+
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultRelayMaxBackoff
+	}
+
+	if cfg.SendTimeout <= 0 {
+		cfg.SendTimeout = cfg.Interval
+	}
+
+	r := &relay{
+		actor: actor,
+		store: store,
+		cfg:   cfg,
+		wake:  make(chan struct{}, 1),
+		sent:  make(map[string]interface{}),
+		next:  make(map[string]time.Time),
+	}
+
+	if r.cfg.Deliver == nil {
+		r.cfg.Deliver = r.sendLocal
+	}
+
+	return r
+}
+
+// sendLocal sends envelope to the registered actor named by target, waits
+// for a full mailbox until SendTimeout or relaying actor is cancelled
+func (r *relay) sendLocal(target string, env *Envelope) error {
+	act, err := Get(target)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.actor.ctx, r.cfg.SendTimeout)
+	defer cancel()
+
+	// envelope does not carry the bounded context to handler
+	if la, ok := act.(*localActor); ok {
+		return la.post(ctx, env)
+	}
+
+	return act.SendContext(ctx, env)
+}
+
+// Commit stores state as snapshot and records outgoing messages in a single
+// BackupStore transaction
+//
+// Outgoing messages are delivered afterwards by outbox relay as *Envelope,
+// with the same message id across retries, thus receivers created with
+// WithDedup process them once. Undelivered messages are delivered by the next
+// actor instance with the same name.
+//
+// state: nil: records outgoing messages only
+func (actor *localActor) Commit(state interface{}, out ...OutboxMessage) error {
+	if actor.relay == nil {
+		return ErrOutboxDisabled
+	}
+
+	var data []byte
+
+	if state != nil {
+		b, err := actor.codec.Marshal(state)
+		if err != nil {
+			actor.log().Error(
+				"snapshot marshal error",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.name),
+				zap.String("uuid", actor.uuid),
+				zap.String("error", err.Error()),
+			)
+
+			return err
+		}
+
+		data = b
+	}
+
+	entries := make([]OutboxEntry, 0, len(out))
+
+	for _, o := range out {
+		payload, err := actor.codec.Marshal(o.Message)
+		if err != nil {
+			actor.log().Error(
+				"outbox message marshal error",
+				zap.String("service", serviceName),
+				zap.String("actor", actor.name),
+				zap.String("uuid", actor.uuid),
+				zap.String("target", o.Target),
+				zap.String("error", err.Error()),
+			)
+
+			return err
+		}
+
+		entries = append(entries, OutboxEntry{
+			ID:      uuid.New().String(),
+			Target:  o.Target,
+			Codec:   actor.codec.Name(),
+			Payload: payload,
+		})
+	}
+
+	// originals are kept before save, thus a flush in between delivers them
+	// instead of decoded messages
+	actor.relay.record(entries, out)
+
+	err := actor.relay.store.SaveOutbox(
+		actor.codec.Name(), data, actor.snapshotKeep, entries)
+	if err != nil {
+		actor.relay.forget(entries)
+		return err
+	}
+
+	actor.relay.notify()
+
+	return nil
+}
+
+// record keeps original messages of this instance
+func (r *relay) record(entries []OutboxEntry, out []OutboxMessage) {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+
+	for idx, e := range entries {
+		r.sent[e.ID] = out[idx].Message
+	}
+}
+
+// forget removes original messages failed to be stored
+func (r *relay) forget(entries []OutboxEntry) {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+
+	for _, e := range entries {
+		delete(r.sent, e.ID)
+	}
+}
+
+// notify wakes up relay
+func (r *relay) notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers outgoing messages until actor is cancelled
+func (r *relay) run() {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.flush()
+
+		select {
+		case <-r.actor.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// flush delivers pending outgoing messages due for delivery
+//
+// messages to a target are delivered in record order, a failed delivery
+// holds back later messages to the same target
+func (r *relay) flush() {
+	entries, err := r.store.PendingOutbox()
+	if err != nil {
+		r.actor.log().Error(
+			"outbox relay error",
+			zap.String("service", serviceName),
+			zap.String("actor", r.actor.name),
+			zap.String("uuid", r.actor.uuid),
+			zap.String("error", err.Error()),
+		)
+
+		return
+	}
+
+	now := time.Now()
+	blocked := make(map[string]bool)
+
+	for _, e := range entries {
+		if blocked[e.Target] {
+			continue
+		}
+
+		r.lock.Lock()
+		next, wait := r.next[e.ID]
+		r.lock.Unlock()
+
+		if wait && now.Before(next) {
+			blocked[e.Target] = true
+			continue
+		}
+
+		if err := r.cfg.Deliver(e.Target, r.envelope(e)); err != nil {
+			blocked[e.Target] = true
+			r.failed(e, err)
+			continue
+		}
+
+		if err := r.store.OutboxDone(e.ID); err != nil {
+			r.actor.log().Error(
+				"outbox done error",
+				zap.String("service", serviceName),
+				zap.String("actor", r.actor.name),
+				zap.String("uuid", r.actor.uuid),
+				zap.String("message id", e.ID),
+				zap.String("error", err.Error()),
+			)
+		}
+
+		r.lock.Lock()
+		delete(r.sent, e.ID)
+		delete(r.next, e.ID)
+		r.lock.Unlock()
+	}
+}
+
+// envelope returns envelope of outgoing message
+//
+// message recorded by previous instance is decoded into interface{}
+func (r *relay) envelope(e OutboxEntry) *Envelope {
+	env := &Envelope{
+		ID:      e.ID,
+		codec:   e.Codec,
+		payload: e.Payload,
+		actor:   r.actor,
+	}
+
+	r.lock.Lock()
+	msg, ok := r.sent[e.ID]
+	r.lock.Unlock()
+
+	if !ok {
+		env.Decode(&msg)
+	}
+
+	env.Message = msg
+
+	return env
+}
+
+// failed records failed delivery and schedules retry with backoff
+func (r *relay) failed(e OutboxEntry, err error) {
+	r.actor.log().Error(
+		"outbox delivery error",
+		zap.String("service", serviceName),
+		zap.String("actor", r.actor.name),
+		zap.String("uuid", r.actor.uuid),
+		zap.String("target", e.Target),
+		zap.String("message id", e.ID),
+		zap.Int("attempts", e.Attempts+1),
+		zap.String("error", err.Error()),
+	)
+
+	if err := r.store.OutboxAttempt(e.ID); err != nil {
+		r.actor.log().Error(
+			"outbox attempt error",
+			zap.String("service", serviceName),
+			zap.String("actor", r.actor.name),
+			zap.String("uuid", r.actor.uuid),
+			zap.String("message id", e.ID),
+			zap.String("error", err.Error()),
+		)
+	}
+
+	backoff := r.cfg.MinBackoff
+	for idx := 0; idx < e.Attempts && backoff < r.cfg.MaxBackoff; idx++ {
+		backoff *= 2
+	}
+
+	if backoff > r.cfg.MaxBackoff {
+		backoff = r.cfg.MaxBackoff
+	}
+
+	r.lock.Lock()
+	r.next[e.ID] = time.Now().Add(backoff)
+	r.lock.Unlock()
+}
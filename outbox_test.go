@@ -0,0 +1,337 @@
+package actor_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestOutbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var lock sync.Mutex
+	var delivered []*actor.Envelope
+	failures := 2
+
+	deliver := func(target string, env *actor.Envelope) error {
+		defer lock.Unlock()
+		lock.Lock()
+
+		if failures > 0 {
+			failures--
+			return errors.New("target unavailable")
+		}
+
+		delivered = append(delivered, env)
+		return nil
+	}
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(actor.NewMemoryBackup().Store),
+			actor.WithOutbox(actor.RelayConfig{
+				Interval:   10 * time.Millisecond,
+				MinBackoff: time.Millisecond,
+				Deliver:    deliver,
+			}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		err = act.Commit(
+			map[string]int{"count": 1},
+			actor.OutboxMessage{Target: "external", Message: "first"},
+			actor.OutboxMessage{Target: "external", Message: "second"},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := make(map[string]int)
+		if err := act.LoadLatestSnapshot(&state); err != nil || state["count"] != 1 {
+			t.Errorf("expecting count: 1, receiving: %v %v", state, err)
+		}
+
+		for idx := 0; idx < 100; idx++ {
+			lock.Lock()
+			n := len(delivered)
+			lock.Unlock()
+
+			if n == 2 {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		// failed delivery holds back later messages, order is preserved
+		if len(delivered) != 2 ||
+			delivered[0].Message != "first" ||
+			delivered[1].Message != "second" {
+			t.Fatalf("expecting: first, second delivered, receiving: %v", delivered)
+		}
+	}
+}
+
+func TestOutboxRelayAfterRestart(t *testing.T) {
+	mem := actor.NewMemoryBackup()
+	cases := createTestCase(2, 0, 0)
+	sender, receiver := cases[0], cases[1]
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	act, err := actor.NewActor(
+		ctx,
+		sender.name,
+		sender.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		sender.backup,
+		actor.WithBackup(mem.Store),
+		actor.WithOutbox(actor.RelayConfig{}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	// receiver is not running, delivery fails
+	err = act.Commit(nil, actor.OutboxMessage{Target: receiver.name, Message: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	waitDeregister(t, sender.name)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	recv, err := actor.NewActor(
+		ctx,
+		receiver.name,
+		receiver.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		-1,
+		actor.WithDedup(actor.DedupConfig{}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	_, err = actor.NewActor(
+		ctx,
+		sender.name,
+		sender.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		sender.backup,
+		actor.WithBackup(mem.Store),
+		actor.WithOutbox(actor.RelayConfig{}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	select {
+	case msg := <-recv.Receive():
+		env := msg.(*actor.Envelope)
+		if env.Message != "hello" {
+			t.Errorf("expecting: hello, receiving: %v", env.Message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+}
+
+// flushStore waits for relay to deliver stored messages before SaveOutbox
+// returns
+type flushStore struct {
+	actor.BackupStore
+	actor.OutboxStore
+	delivered chan struct{}
+}
+
+func (s flushStore) SaveOutbox(
+	codec string,
+	state []byte,
+	keep int,
+	out []actor.OutboxEntry,
+) error {
+	if err := s.OutboxStore.SaveOutbox(codec, state, keep, out); err != nil {
+		return err
+	}
+
+	select {
+	case <-s.delivered:
+	case <-time.After(5 * time.Second):
+	}
+
+	return nil
+}
+
+func TestOutboxFlushDuringCommit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	type greeting struct {
+		Text string
+	}
+
+	delivered := make(chan struct{})
+	var received interface{}
+
+	deliver := func(target string, env *actor.Envelope) error {
+		received = env.Message
+		close(delivered)
+		return nil
+	}
+
+	mem := actor.NewMemoryBackup()
+	factory := func(
+		ctx context.Context,
+		name, uuid string,
+		rotate int,
+	) (actor.BackupStore, error) {
+		store, err := mem.Store(ctx, name, uuid, rotate)
+		if err != nil {
+			return nil, err
+		}
+
+		return flushStore{store, store.(actor.OutboxStore), delivered}, nil
+	}
+
+	for _, tc := range createTestCase(1, 0, 0) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithBackup(factory),
+			actor.WithOutbox(actor.RelayConfig{
+				Interval: 10 * time.Millisecond,
+				Deliver:  deliver,
+			}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		err = act.Commit(nil, actor.OutboxMessage{
+			Target:  "external",
+			Message: greeting{"hello"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// flushed before Commit returns, the original message is delivered
+		if received != (greeting{"hello"}) {
+			t.Fatalf("expecting: %v, receiving: %#v", greeting{"hello"}, received)
+		}
+	}
+}
+
+func TestOutboxFullMailbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(2, 1, 0)
+	sender, receiver := cases[0], cases[1]
+
+	recv, err := actor.NewActor(
+		ctx,
+		receiver.name,
+		receiver.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		-1,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	recv.Send("filler")
+
+	var buf logBuffer
+
+	_, err = actor.NewActor(
+		ctx,
+		sender.name,
+		sender.buffer,
+		func(act actor.Actor) {
+			act.Commit(nil, actor.OutboxMessage{Target: receiver.name, Message: "hello"})
+			<-act.Done()
+		},
+		sender.backup,
+		actor.WithBackup(actor.NewMemoryBackup().Store),
+		actor.WithLogger(debugLogger(&buf)),
+		actor.WithOutbox(actor.RelayConfig{
+			Interval:    10 * time.Millisecond,
+			MinBackoff:  time.Millisecond,
+			SendTimeout: 10 * time.Millisecond,
+		}),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	// full mailbox fails the attempt instead of blocking the relay
+	for idx := 0; idx < 500 && !strings.Contains(buf.String(), "outbox delivery error"); idx++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(buf.String(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("expecting: failed attempt by %v, receiving:\n%s",
+			context.DeadlineExceeded, buf.String())
+	}
+
+	for _, expect := range []string{"filler", "hello"} {
+		select {
+		case msg := <-recv.Receive():
+			if env, ok := msg.(*actor.Envelope); ok {
+				msg = env.Message
+			}
+
+			if msg != expect {
+				t.Fatalf("expecting: %s, receiving: %v", expect, msg)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+}
+
+func TestOutboxDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, -1) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if err := act.Commit(1); err != actor.ErrOutboxDisabled {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrOutboxDisabled, err)
+		}
+	}
+}
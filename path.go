@@ -0,0 +1,69 @@
+package actor
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type pathKey struct{}
+
+// number of hops recorded in message path, 0: disabled
+var pathLimit int64
+
+// SetMessagePath enables recording actors forwarded a message in
+// Envelope.Path
+//
+// A hop is appended when a handler forwards the received *Envelope by Send,
+// or sends with the context returned by Envelope.Context or Envelope.Handle
+// by SendContext. Only the latest limit hops are kept.
+//
+// limit: <= 0: disable message path
+func SetMessagePath(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+
+	atomic.StoreInt64(&pathLimit, int64(limit))
+}
+
+func getPathLimit() int {
+	return int(atomic.LoadInt64(&pathLimit))
+}
+
+// appendHop returns a copy of path with hop appended, bounded by limit
+func appendHop(path []string, hop string, limit int) []string {
+	if len(path) >= limit {
+		path = path[len(path)-limit+1:]
+	}
+
+	p := make([]string, 0, len(path)+1)
+	p = append(p, path...)
+
+	return append(p, hop)
+}
+
+// forwardPath returns path of message forwarded by receiving actor of e
+func (e *Envelope) forwardPath() []string {
+	limit := getPathLimit()
+	if limit == 0 || e.actor == nil {
+		return nil
+	}
+
+	return appendHop(e.Path, e.actor.name, limit)
+}
+
+// withPath returns ctx carries path of message forwarded by receiving actor
+// of e
+func (e *Envelope) withPath(ctx context.Context) context.Context {
+	if path := e.forwardPath(); path != nil {
+		return context.WithValue(ctx, pathKey{}, path)
+	}
+
+	return ctx
+}
+
+// pathFromContext returns message path carried by ctx
+func pathFromContext(ctx context.Context) []string {
+	path, _ := ctx.Value(pathKey{}).([]string)
+	return path
+}
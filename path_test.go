@@ -0,0 +1,205 @@
+package actor_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// forwardPipeline creates pipe1 -> pipe2 -> logger, pipe1 forwards envelope by
+// Send, pipe2 forwards message by SendContext, logger reports received path
+func forwardPipeline(
+	t *testing.T,
+	ctx context.Context,
+) (actor.Actor, actor.Actor, <-chan []string) {
+	cases := createTestCase(3, 0, -1)
+	paths := make(chan []string, 1)
+
+	logger, err := actor.NewActor(
+		ctx,
+		cases[2].name,
+		cases[2].buffer,
+		func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			paths <- env.Path
+			<-act.Done()
+		},
+		cases[2].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe2, err := actor.NewActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			ctx, end := env.Handle()
+			logger.SendContext(ctx, env.Message)
+			end()
+			<-act.Done()
+		},
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe1, err := actor.NewActor(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(act actor.Actor) {
+			pipe2.Send(<-act.Receive())
+			<-act.Done()
+		},
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	return pipe1, pipe2, paths
+}
+
+func receivePath(t *testing.T, paths <-chan []string) []string {
+	select {
+	case p := <-paths:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	return nil
+}
+
+func TestMessagePath(t *testing.T) {
+	actor.SetMessagePath(8)
+	defer actor.SetMessagePath(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pipe1, pipe2, paths := forwardPipeline(t, ctx)
+
+	if err := pipe1.Send(actor.NewEnvelope("hop")); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{pipe1.Name(), pipe2.Name()}
+	if path := receivePath(t, paths); !reflect.DeepEqual(path, expect) {
+		t.Fatalf("expecting: %v, receiving: %v", expect, path)
+	}
+}
+
+func TestMessagePathLimit(t *testing.T) {
+	actor.SetMessagePath(1)
+	defer actor.SetMessagePath(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pipe1, pipe2, paths := forwardPipeline(t, ctx)
+
+	if err := pipe1.Send(actor.NewEnvelope("hop")); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the latest hop is kept
+	expect := []string{pipe2.Name()}
+	if path := receivePath(t, paths); !reflect.DeepEqual(path, expect) {
+		t.Fatalf("expecting: %v, receiving: %v", expect, path)
+	}
+}
+
+func TestMessagePathDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pipe1, _, paths := forwardPipeline(t, ctx)
+
+	if err := pipe1.Send(actor.NewEnvelope("hop")); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := receivePath(t, paths); len(path) != 0 {
+		t.Fatalf("expecting: empty path, receiving: %v", path)
+	}
+}
+
+func TestPanicReport(t *testing.T) {
+	actor.SetMessagePath(8)
+	defer actor.SetMessagePath(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	cases := createTestCase(2, 0, -1)
+
+	crash, err := actor.NewActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			env.Handle()
+			panic("crash")
+		},
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe, err := actor.NewActor(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(act actor.Actor) {
+			crash.Send(<-act.Receive())
+			<-act.Done()
+		},
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	env := actor.NewEnvelope("crash")
+	if err := pipe.Send(env); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case ev := <-sub.C:
+			p, ok := ev.(actor.Panic)
+			if !ok || p.Actor != crash.Name() {
+				continue
+			}
+
+			if p.Envelope == nil || p.Envelope.ID != env.ID {
+				t.Fatalf("expecting: message id %s, receiving: %v", env.ID, p.Envelope)
+			}
+
+			expect := []string{pipe.Name()}
+			if !reflect.DeepEqual(p.Envelope.Path, expect) {
+				t.Fatalf("expecting: %v, receiving: %v", expect, p.Envelope.Path)
+			}
+
+			return
+		case <-timeout:
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// header key carries context deadline
+const deadlineHeader = "actor-deadline"
+
+type (
+	// Header carries request-scoped values of a message across remote
+	// transports
+	Header map[string]string
+
+	// Propagator injects request-scoped values of context into Header, and
+	// extracts them on the receiving side
+	Propagator interface {
+		Inject(ctx context.Context, h Header)
+		Extract(ctx context.Context, h Header) context.Context
+	}
+)
+
+var (
+	propagatorLock sync.RWMutex
+	propagators    = []Propagator{TraceContext{}}
+)
+
+// RegisterPropagator registers Propagator used by InjectContext and
+// ExtractContext
+func RegisterPropagator(p Propagator) {
+	defer propagatorLock.Unlock()
+	propagatorLock.Lock()
+
+	propagators = append(propagators, p)
+}
+
+func getPropagators() []Propagator {
+	defer propagatorLock.RUnlock()
+	propagatorLock.RLock()
+
+	return propagators
+}
+
+// InjectContext writes ctx's deadline and values of registered propagators
+// into h
+//
+// returns h, allocated if h is nil
+func InjectContext(ctx context.Context, h Header) Header {
+	if h == nil {
+		h = make(Header)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		h[deadlineHeader] = deadline.Format(time.RFC3339Nano)
+	}
+
+	for _, p := range getPropagators() {
+		p.Inject(ctx, h)
+	}
+
+	return h
+}
+
+// ExtractContext returns context derived from parent with deadline and
+// values carried by h
+//
+// Remote transport calls ExtractContext on receiving a message, and cancel
+// once the message is processed.
+func ExtractContext(
+	parent context.Context,
+	h Header,
+) (context.Context, context.CancelFunc) {
+	ctx := parent
+
+	for _, p := range getPropagators() {
+		ctx = p.Extract(ctx, h)
+	}
+
+	if v, ok := h[deadlineHeader]; ok {
+		if deadline, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return context.WithDeadline(ctx, deadline)
+		}
+	}
+
+	return context.WithCancel(ctx)
+}
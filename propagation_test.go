@@ -0,0 +1,135 @@
+package actor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+type tenantKey struct{}
+
+// tenantPropagator propagates tenant value of context
+type tenantPropagator struct{}
+
+func (tenantPropagator) Inject(ctx context.Context, h actor.Header) {
+	if v, ok := ctx.Value(tenantKey{}).(string); ok {
+		h["tenant"] = v
+	}
+}
+
+func (tenantPropagator) Extract(ctx context.Context, h actor.Header) context.Context {
+	if v, ok := h["tenant"]; ok {
+		return context.WithValue(ctx, tenantKey{}, v)
+	}
+
+	return ctx
+}
+
+func TestSendContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(2, 0, -1)
+
+	// forwarder propagates message context to receiver
+	recv, err := actor.NewActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		func(act actor.Actor) { <-act.Done() },
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	fwd, err := actor.NewActor(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(act actor.Actor) {
+			for {
+				select {
+				case <-act.Done():
+					return
+				case msg := <-act.Receive():
+					env := msg.(*actor.Envelope)
+					recv.SendContext(env.Context(), env.Message)
+				}
+			}
+		},
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	reqCtx, reqCancel := context.WithTimeout(
+		context.WithValue(ctx, tenantKey{}, "acme"), time.Minute)
+	defer reqCancel()
+
+	if err := fwd.SendContext(reqCtx, "request"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-recv.Receive():
+		env := msg.(*actor.Envelope)
+
+		if env.Message != "request" {
+			t.Errorf("expecting: request, receiving: %v", env.Message)
+		}
+
+		if env.Context().Value(tenantKey{}) != "acme" {
+			t.Error("expecting context value propagated")
+		}
+
+		if _, ok := env.Context().Deadline(); !ok {
+			t.Error("expecting context deadline propagated")
+		}
+
+		reqCancel()
+
+		if env.Context().Err() != context.Canceled {
+			t.Error("expecting context cancellation propagated")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	// cancelled context unblocks send to busy actor
+	blockCtx, blockCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer blockCancel()
+
+	if err := recv.SendContext(blockCtx, "blocked"); err != context.DeadlineExceeded {
+		t.Errorf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+	}
+
+	if err := recv.SendContext(blockCtx, "expired"); err != context.DeadlineExceeded {
+		t.Errorf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestContextHeader(t *testing.T) {
+	actor.RegisterPropagator(tenantPropagator{})
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(
+		context.WithValue(context.Background(), tenantKey{}, "acme"), deadline)
+	defer cancel()
+
+	h := actor.InjectContext(ctx, nil)
+
+	remote, remoteCancel := actor.ExtractContext(context.Background(), h)
+	defer remoteCancel()
+
+	if d, ok := remote.Deadline(); !ok || !d.Equal(deadline) {
+		t.Errorf("expecting deadline: %v, receiving: %v", deadline, d)
+	}
+
+	if remote.Value(tenantKey{}) != "acme" {
+		t.Error("expecting tenant extracted")
+	}
+}
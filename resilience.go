@@ -0,0 +1,374 @@
+package actor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/eapache/go-resiliency/semaphore"
+	l "github.com/vsdmars/actor/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// circuit breaker states
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+type (
+	// CircuitState is the state of circuit breaker of a target actor
+	CircuitState string
+
+	// ResilienceConfig configures Resilient
+	ResilienceConfig struct {
+		// BreakerErrors is the number of failures within BreakerTimeout
+		// opens the breaker, <= 0: 5
+		BreakerErrors int
+		// BreakerSuccesses is the number of successes closes half-open
+		// breaker, <= 0: 1
+		BreakerSuccesses int
+		// BreakerTimeout is the duration breaker stays open before
+		// half-open, <= 0: 10s
+		BreakerTimeout time.Duration
+		// Retries is the number of retries after a failed attempt
+		Retries int
+		// Backoff is the wait before the first retry, doubled per retry,
+		// <= 0: 10ms
+		Backoff time.Duration
+		// Jitter randomizes backoff by the factor within [0, 1]
+		Jitter float64
+		// AskTimeout bounds the wait of each Ask attempt, <= 0: caller's
+		// context only
+		AskTimeout time.Duration
+		// MaxInFlight is the number of concurrent asks per target,
+		// <= 0: unbounded
+		MaxInFlight int
+		// BulkheadTimeout is the wait for an in-flight slot, <= 0: 1ms
+		BulkheadTimeout time.Duration
+	}
+
+	// Resilient sends messages to actors by name with circuit breaker,
+	// retry and bulkhead per target actor
+	//
+	// Attempts failed by ErrChannelClosed, ErrRetrieveActor or Ask timeout
+	// are counted by target's breaker and retried with exponential backoff,
+	// the target is resolved by name per attempt, thus an actor restarted
+	// with the same name receives retried messages. Attempts succeeded are
+	// counted as successes, other errors and errors caused by caller's ctx
+	// are not counted. Breaker state changes are published as
+	// CircuitStateChange events.
+	Resilient struct {
+		cfg     ResilienceConfig
+		lock    sync.Mutex
+		targets map[string]*circuit
+	}
+
+	// circuit is the breaker and bulkhead of a target actor
+	//
+	// Breaker opens once failures within timeout reach errors, or on any
+	// failure while half-open, turns half-open once timeout elapses, and
+	// closes once successes while half-open reach threshold.
+	circuit struct {
+		name      string
+		errors    int                  // failures opens closed breaker
+		threshold int                  // successes closes half-open breaker
+		timeout   time.Duration        // failure window and open duration
+		bulkhead  *semaphore.Semaphore // nil: unbounded
+		lock      sync.Mutex           // guards fields below
+		state     CircuitState
+		failures  []time.Time // failures while closed within timeout
+		successes int         // successes while half-open
+		timer     *time.Timer // turns open breaker half-open
+	}
+)
+
+// NewResilient creates Resilient with cfg
+func NewResilient(cfg ResilienceConfig) *Resilient {
+	if cfg.BreakerErrors <= 0 {
+		cfg.BreakerErrors = 5
+	}
+
+	if cfg.BreakerSuccesses <= 0 {
+		cfg.BreakerSuccesses = 1
+	}
+
+	if cfg.BreakerTimeout <= 0 {
+		cfg.BreakerTimeout = 10 * time.Second
+	}
+
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 10 * time.Millisecond
+	}
+
+	// semaphore with zero timeout may reject while a slot is free
+	if cfg.BulkheadTimeout <= 0 {
+		cfg.BulkheadTimeout = time.Millisecond
+	}
+
+	return &Resilient{
+		cfg:     cfg,
+		targets: make(map[string]*circuit),
+	}
+}
+
+// Send sends message to actor registered by name
+//
+// message is delivered as is, handler receives *Envelope only if message is
+// an *Envelope, as Actor.Send does. Unlike Actor.Send, the wait for a full
+// mailbox is bounded by ctx.
+//
+// returns ErrCircuitOpen if target's breaker is open, ctx.Err() if ctx is
+// done, or error of the last attempt.
+func (r *Resilient) Send(ctx context.Context, name string, message interface{}) error {
+	return r.run(ctx, r.circuit(name), func(ctx context.Context) error {
+		act, err := Get(name)
+		if err != nil {
+			return err
+		}
+
+		if la, ok := act.(*localActor); ok {
+			return la.post(ctx, message)
+		}
+
+		return act.SendContext(ctx, message)
+	})
+}
+
+// Ask asks actor registered by name, see Ask
+//
+// returns ErrBulkheadFull if MaxInFlight asks to target are in flight,
+// ErrCircuitOpen if target's breaker is open, ctx.Err() if ctx is done, or
+// error of the last attempt, context.DeadlineExceeded for AskTimeout.
+func (r *Resilient) Ask(ctx context.Context, name string, message interface{}) (interface{}, error) {
+	c := r.circuit(name)
+
+	if c.bulkhead != nil {
+		if err := c.bulkhead.Acquire(); err != nil {
+			return nil, ErrBulkheadFull
+		}
+		defer c.bulkhead.Release()
+	}
+
+	var reply interface{}
+
+	err := r.run(ctx, c, func(ctx context.Context) error {
+		act, err := Get(name)
+		if err != nil {
+			return err
+		}
+
+		if r.cfg.AskTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.cfg.AskTimeout)
+			defer cancel()
+		}
+
+		reply, err = Ask(ctx, act, message)
+
+		return err
+	})
+
+	return reply, err
+}
+
+// State returns breaker state of target actor
+func (r *Resilient) State(name string) CircuitState {
+	c := r.circuit(name)
+
+	defer c.lock.Unlock()
+	c.lock.Lock()
+
+	return c.state
+}
+
+func (r *Resilient) circuit(name string) *circuit {
+	defer r.lock.Unlock()
+	r.lock.Lock()
+
+	c, ok := r.targets[name]
+	if !ok {
+		c = &circuit{
+			name:      name,
+			errors:    r.cfg.BreakerErrors,
+			threshold: r.cfg.BreakerSuccesses,
+			timeout:   r.cfg.BreakerTimeout,
+			state:     CircuitClosed,
+		}
+
+		if r.cfg.MaxInFlight > 0 {
+			c.bulkhead = semaphore.New(r.cfg.MaxInFlight, r.cfg.BulkheadTimeout)
+		}
+
+		r.targets[name] = c
+	}
+
+	return c
+}
+
+// run runs attempt through target's breaker, retries failed attempts
+func (r *Resilient) run(
+	ctx context.Context,
+	c *circuit,
+	attempt func(context.Context) error,
+) error {
+	// retrier is not safe for concurrent use
+	ret := retrier.New(
+		retrier.ExponentialBackoff(r.cfg.Retries, r.cfg.Backoff),
+		failureClassifier{ctx},
+	)
+	ret.SetJitter(r.cfg.Jitter)
+
+	return ret.Run(func() error {
+		if !c.allow() {
+			return ErrCircuitOpen
+		}
+
+		err := attempt(ctx)
+
+		// errors caused by caller's ctx or other than failures of target are
+		// not counted
+		switch {
+		case err == nil:
+			c.succeeded()
+		case ctx.Err() == nil && isFailure(err):
+			c.failed()
+		}
+
+		return err
+	})
+}
+
+// allow reports whether breaker lets a call through
+func (c *circuit) allow() bool {
+	defer c.lock.Unlock()
+	c.lock.Lock()
+
+	return c.state != CircuitOpen
+}
+
+// failed counts failure, opens breaker once failures reach the threshold
+// or on any failure while half-open
+func (c *circuit) failed() {
+	now := time.Now()
+
+	c.lock.Lock()
+	from := c.state
+
+	switch from {
+	case CircuitClosed:
+		// failures out of window are expired
+		idx := 0
+		for idx < len(c.failures) && now.Sub(c.failures[idx]) > c.timeout {
+			idx++
+		}
+		c.failures = append(c.failures[idx:], now)
+
+		if len(c.failures) >= c.errors {
+			c.open()
+		}
+	case CircuitHalfOpen:
+		c.open()
+	}
+	to := c.state
+	c.lock.Unlock()
+
+	c.report(from, to)
+}
+
+// succeeded counts success, closes half-open breaker once successes reach
+// the threshold
+func (c *circuit) succeeded() {
+	c.lock.Lock()
+	from := c.state
+
+	if from == CircuitHalfOpen {
+		c.successes++
+		if c.successes >= c.threshold {
+			c.state = CircuitClosed
+			c.failures = nil
+		}
+	}
+	to := c.state
+	c.lock.Unlock()
+
+	c.report(from, to)
+}
+
+// open opens breaker, breaker turns half-open once timeout elapses
+//
+// c.lock is held by caller
+func (c *circuit) open() {
+	c.state = CircuitOpen
+	c.failures = nil
+
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(c.timeout, func() {
+		c.lock.Lock()
+		// breaker re-opened since, its own timer turns it half-open
+		if c.timer != timer {
+			c.lock.Unlock()
+			return
+		}
+
+		c.state, c.successes, c.timer = CircuitHalfOpen, 0, nil
+		c.lock.Unlock()
+
+		c.report(CircuitOpen, CircuitHalfOpen)
+	})
+	c.timer = timer
+}
+
+// report logs and publishes state change
+func (c *circuit) report(from, to CircuitState) {
+	if from == to {
+		return
+	}
+
+	l.GetLog().Warn(
+		"circuit state change",
+		zap.String("service", serviceName),
+		zap.String("actor", c.name),
+		zap.String("from", string(from)),
+		zap.String("to", string(to)),
+	)
+
+	publish(CircuitStateChange{
+		Target: c.name,
+		From:   from,
+		To:     to,
+		Time:   time.Now(),
+	})
+}
+
+// isFailure reports whether err is a failure of target actor
+func isFailure(err error) bool {
+	return errors.Is(err, ErrChannelClosed) ||
+		errors.Is(err, ErrRetrieveActor) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// failureClassifier retries failures of target actor until ctx is done
+type failureClassifier struct {
+	ctx context.Context
+}
+
+// Classify implements retrier.Classifier
+func (f failureClassifier) Classify(err error) retrier.Action {
+	switch {
+	case err == nil:
+		return retrier.Succeed
+	case f.ctx.Err() == nil && isFailure(err):
+		return retrier.Retry
+	default:
+		return retrier.Fail
+	}
+}
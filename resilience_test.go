@@ -0,0 +1,293 @@
+package actor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// createResponder creates actor replies to Request by reply(message)
+func createResponder(
+	t *testing.T,
+	ctx context.Context,
+	name string,
+	reply func(msg interface{}) interface{},
+) actor.Actor {
+	t.Helper()
+
+	act, err := actor.NewActor(
+		ctx,
+		name,
+		10,
+		func(act actor.Actor) {
+			for {
+				select {
+				case <-act.Done():
+					return
+				case msg := <-act.Receive():
+					if env, ok := msg.(*actor.Envelope); ok {
+						if req, ok := env.Message.(*actor.Request); ok {
+							req.Respond(reply(req.Message))
+						}
+					}
+				}
+			}
+		},
+		-1,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	return act
+}
+
+// expectCircuit receives circuit state changes of target from sub
+func expectCircuit(t *testing.T, sub *actor.Subscription, target string, expect ...string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+
+	for _, e := range expect {
+		for {
+			var ev interface{}
+
+			select {
+			case ev = <-sub.C:
+			case <-timeout:
+				t.Fatal(actorTimeoutErr)
+			}
+
+			c, ok := ev.(actor.CircuitStateChange)
+			if !ok || c.Target != target {
+				continue
+			}
+
+			if got := string(c.From) + ">" + string(c.To); got != e {
+				t.Fatalf("expecting: circuit %s, receiving: %s", e, got)
+			}
+
+			break
+		}
+	}
+}
+
+func TestAsk(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tc := createTestCase(1, 10, -1)[0]
+	act := createResponder(t, ctx, tc.name, func(msg interface{}) interface{} {
+		return msg.(int) * 2
+	})
+
+	askCtx, askCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer askCancel()
+
+	reply, err := actor.Ask(askCtx, act, 21)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply != 42 {
+		t.Fatalf("expecting: 42, receiving: %v", reply)
+	}
+}
+
+func TestResilientBreaker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := actor.Subscribe(0)
+	defer sub.Unsubscribe()
+
+	r := actor.NewResilient(actor.ResilienceConfig{
+		BreakerErrors:  2,
+		BreakerTimeout: 100 * time.Millisecond,
+	})
+
+	tc := createTestCase(1, 10, -1)[0]
+
+	// target is not registered yet
+	for idx := 0; idx < 2; idx++ {
+		if err := r.Send(ctx, tc.name, idx); err != actor.ErrRetrieveActor {
+			t.Fatalf("expecting: %v, receiving: %v", actor.ErrRetrieveActor, err)
+		}
+	}
+
+	expectCircuit(t, sub, tc.name, "closed>open")
+
+	if err := r.Send(ctx, tc.name, 2); err != actor.ErrCircuitOpen {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrCircuitOpen, err)
+	}
+
+	// breaker half-opens after timeout
+	expectCircuit(t, sub, tc.name, "open>half-open")
+
+	if s := r.State(tc.name); s != actor.CircuitHalfOpen {
+		t.Fatalf("expecting: %s, receiving: %s", actor.CircuitHalfOpen, s)
+	}
+
+	// failure while half-open opens the breaker
+	if err := r.Send(ctx, tc.name, 3); err != actor.ErrRetrieveActor {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrRetrieveActor, err)
+	}
+
+	expectCircuit(t, sub, tc.name, "half-open>open", "open>half-open")
+
+	// caller giving up is neither failure nor success of target
+	doneCtx, doneCancel := context.WithCancel(ctx)
+	doneCancel()
+
+	if err := r.Send(doneCtx, tc.name, 3); err == nil {
+		t.Fatal("expecting: error, receiving: nil")
+	}
+
+	if s := r.State(tc.name); s != actor.CircuitHalfOpen {
+		t.Fatalf("expecting: %s, receiving: %s", actor.CircuitHalfOpen, s)
+	}
+
+	received := make(chan interface{}, 1)
+	_, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) {
+			select {
+			case <-act.Done():
+			case msg := <-act.Receive():
+				received <- msg
+			}
+		},
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if err := r.Send(ctx, tc.name, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	expectCircuit(t, sub, tc.name, "half-open>closed")
+
+	// message is delivered as is
+	if msg := <-received; msg != 4 {
+		t.Fatalf("expecting: 4, receiving: %v", msg)
+	}
+
+	if s := r.State(tc.name); s != actor.CircuitClosed {
+		t.Fatalf("expecting: %s, receiving: %s", actor.CircuitClosed, s)
+	}
+}
+
+func TestResilientRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := actor.NewResilient(actor.ResilienceConfig{
+		BreakerErrors: 100,
+		Retries:       8,
+		Backoff:       5 * time.Millisecond,
+		Jitter:        0.5,
+	})
+
+	tc := createTestCase(1, 10, -1)[0]
+
+	// target registers while sender retries
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		createResponder(t, ctx, tc.name, func(msg interface{}) interface{} { return msg })
+	}()
+
+	askCtx, askCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer askCancel()
+
+	reply, err := r.Ask(askCtx, tc.name, "ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply != "ping" {
+		t.Fatalf("expecting: ping, receiving: %v", reply)
+	}
+}
+
+func TestResilientBulkhead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := actor.NewResilient(actor.ResilienceConfig{
+		AskTimeout:  time.Second,
+		MaxInFlight: 1,
+	})
+
+	release := make(chan struct{})
+	received := make(chan struct{}, 1)
+
+	tc := createTestCase(1, 10, -1)[0]
+	createResponder(t, ctx, tc.name, func(msg interface{}) interface{} {
+		received <- struct{}{}
+		<-release
+
+		return msg
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		if _, err := r.Ask(ctx, tc.name, "first"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	if _, err := r.Ask(ctx, tc.name, "second"); err != actor.ErrBulkheadFull {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrBulkheadFull, err)
+	}
+
+	close(release)
+	wg.Wait()
+}
+
+func TestResilientAskTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r := actor.NewResilient(actor.ResilienceConfig{
+		BreakerErrors: 1,
+		AskTimeout:    20 * time.Millisecond,
+	})
+
+	tc := createTestCase(1, 10, -1)[0]
+	_, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if _, err := r.Ask(ctx, tc.name, "ping"); err != context.DeadlineExceeded {
+		t.Fatalf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+	}
+
+	// ask timeout opens the breaker
+	if s := r.State(tc.name); s != actor.CircuitOpen {
+		t.Fatalf("expecting: %s, receiving: %s", actor.CircuitOpen, s)
+	}
+}
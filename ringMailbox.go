@@ -0,0 +1,256 @@
+package actor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// RingMailbox is a bounded multi-producer single-consumer ring buffer
+	//
+	// Push and Send are lock-free and do not allocate, values of type T are
+	// stored without interface boxing. A single consumer dequeues messages
+	// in batch by Receive or TryReceive.
+	RingMailbox[T any] struct {
+		_       [64]byte
+		tail    uint64 // atomic, next enqueue position
+		_       [56]byte
+		head    uint64 // atomic, next dequeue position, written by consumer
+		_       [56]byte
+		waiting uint32 // atomic, 1: consumer waits for wake
+		senders int32  // atomic, Send parked while mailbox is full
+		mask    uint64
+		slots   []ringSlot[T]
+		wake    chan struct{}
+		done    chan struct{}
+		once    sync.Once
+		// space holds a token per slot freed while Send is parked
+		space chan struct{}
+	}
+
+	// ringSlot is ready for enqueue at position seq, and ready for dequeue
+	// at position seq-1
+	ringSlot[T any] struct {
+		seq uint64 // atomic
+		val T
+	}
+)
+
+// NewRingMailbox returns RingMailbox holds capacity messages
+//
+// capacity: rounded up to power of two, at least 2, since a single slot
+// ready for dequeue is indistinguishable from ready for the next enqueue
+func NewRingMailbox[T any](capacity int) *RingMailbox[T] {
+	size := 2
+	for size < capacity {
+		size <<= 1
+	}
+
+	r := &RingMailbox[T]{
+		mask:  uint64(size - 1),
+		slots: make([]ringSlot[T], size),
+		wake:  make(chan struct{}, 1),
+		done:  make(chan struct{}),
+		space: make(chan struct{}, size),
+	}
+
+	for idx := range r.slots {
+		r.slots[idx].seq = uint64(idx)
+	}
+
+	return r
+}
+
+// Push enqueues v, returns false if mailbox is full or closed
+func (r *RingMailbox[T]) Push(v T) bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+
+	for {
+		pos := atomic.LoadUint64(&r.tail)
+		slot := &r.slots[pos&r.mask]
+		seq := atomic.LoadUint64(&slot.seq)
+
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&r.tail, pos, pos+1) {
+				slot.val = v
+				atomic.StoreUint64(&slot.seq, pos+1)
+				r.notify()
+
+				return true
+			}
+		case dif < 0:
+			// slot is not dequeued yet
+			return false
+		}
+	}
+}
+
+// Send enqueues v, blocks while mailbox is full
+//
+// blocked Send is parked until consumer frees a slot, each freed slot
+// wakes up one parked Send.
+//
+// returns ctx.Err() if ctx is done, ErrChannelClosed if mailbox is closed
+func (r *RingMailbox[T]) Send(ctx context.Context, v T) error {
+	for !r.Push(v) {
+		atomic.AddInt32(&r.senders, 1)
+
+		// slot freed before consumer sees parked Send
+		if r.Push(v) {
+			atomic.AddInt32(&r.senders, -1)
+			return nil
+		}
+
+		var err error
+
+		select {
+		case <-r.space:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-r.done:
+			err = ErrChannelClosed
+		}
+
+		atomic.AddInt32(&r.senders, -1)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TryReceive dequeues up to len(buf) messages into buf without blocking
+//
+// returns number of dequeued messages. TryReceive is called by the single
+// consumer only.
+func (r *RingMailbox[T]) TryReceive(buf []T) int {
+	var zero T
+
+	head := atomic.LoadUint64(&r.head)
+	n := 0
+
+	for n < len(buf) {
+		slot := &r.slots[head&r.mask]
+		if atomic.LoadUint64(&slot.seq) != head+1 {
+			break
+		}
+
+		buf[n] = slot.val
+		slot.val = zero // release reference to message
+		atomic.StoreUint64(&slot.seq, head+r.mask+1)
+
+		head++
+		n++
+	}
+
+	atomic.StoreUint64(&r.head, head)
+
+	if n > 0 {
+		if senders := int(atomic.LoadInt32(&r.senders)); senders > 0 {
+			r.release(min(n, senders))
+		}
+	}
+
+	return n
+}
+
+// Receive dequeues up to len(buf) messages into buf, blocks until at least
+// one message is dequeued
+//
+// returns ctx.Err() if ctx is done, ErrChannelClosed if mailbox is closed
+// and empty. Receive is called by the single consumer only.
+func (r *RingMailbox[T]) Receive(ctx context.Context, buf []T) (int, error) {
+	for {
+		if n := r.TryReceive(buf); n > 0 {
+			return n, nil
+		}
+
+		atomic.StoreUint32(&r.waiting, 1)
+
+		// message enqueued before producer sees waiting
+		if n := r.TryReceive(buf); n > 0 {
+			atomic.StoreUint32(&r.waiting, 0)
+			return n, nil
+		}
+
+		select {
+		case <-r.wake:
+		case <-ctx.Done():
+			atomic.StoreUint32(&r.waiting, 0)
+			return 0, ctx.Err()
+		case <-r.done:
+			atomic.StoreUint32(&r.waiting, 0)
+
+			if n := r.TryReceive(buf); n > 0 {
+				return n, nil
+			}
+
+			return 0, ErrChannelClosed
+		}
+	}
+}
+
+// Len returns number of messages in mailbox
+func (r *RingMailbox[T]) Len() int {
+	head := atomic.LoadUint64(&r.head)
+	tail := atomic.LoadUint64(&r.tail)
+
+	if tail <= head {
+		return 0
+	}
+
+	// tail may include slots being written
+	if n := int(tail - head); n < r.Cap() {
+		return n
+	}
+
+	return r.Cap()
+}
+
+// Cap returns capacity of mailbox
+func (r *RingMailbox[T]) Cap() int {
+	return len(r.slots)
+}
+
+// Close stops accepting messages, wakes up blocked Send and Receive
+//
+// messages enqueued before Close are still received.
+func (r *RingMailbox[T]) Close() {
+	r.once.Do(func() {
+		close(r.done)
+	})
+}
+
+// release wakes up n Send parked while mailbox is full
+//
+// tokens left by Send returned otherwise wake up Send parked later, which
+// retries Push.
+func (r *RingMailbox[T]) release(n int) {
+	for idx := 0; idx < n; idx++ {
+		select {
+		case r.space <- struct{}{}:
+		default:
+			// pending tokens wake up enough Send
+			return
+		}
+	}
+}
+
+// notify wakes up consumer waiting for messages
+func (r *RingMailbox[T]) notify() {
+	if atomic.LoadUint32(&r.waiting) == 1 &&
+		atomic.CompareAndSwapUint32(&r.waiting, 1, 0) {
+		select {
+		case r.wake <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package actor_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestRingMailbox(t *testing.T) {
+	r := actor.NewRingMailbox[int](3)
+
+	if r.Cap() != 4 {
+		t.Fatalf("expecting: capacity 4, receiving: %d", r.Cap())
+	}
+
+	for idx := 0; idx < 4; idx++ {
+		if !r.Push(idx) {
+			t.Fatalf("expecting: push %d", idx)
+		}
+	}
+
+	if r.Push(4) || r.Len() != 4 {
+		t.Fatalf("expecting: full mailbox, receiving: %d messages", r.Len())
+	}
+
+	buf := make([]int, 3)
+	if n := r.TryReceive(buf); n != 3 || buf[0] != 0 || buf[2] != 2 {
+		t.Fatalf("expecting: [0 1 2], receiving: %v", buf[:n])
+	}
+
+	// ring wraps around
+	if !r.Push(4) || !r.Push(5) {
+		t.Fatal("expecting: push after receive")
+	}
+
+	if n := r.TryReceive(buf); n != 3 || buf[0] != 3 || buf[2] != 5 {
+		t.Fatalf("expecting: [3 4 5], receiving: %v", buf[:n])
+	}
+
+	if n := r.TryReceive(buf); n != 0 || r.Len() != 0 {
+		t.Fatalf("expecting: empty mailbox, receiving: %d messages", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := r.Receive(ctx, buf); err != context.DeadlineExceeded {
+		t.Fatalf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+	}
+
+	r.Push(6)
+	r.Close()
+
+	if r.Push(7) {
+		t.Fatal("expecting: push rejected by closed mailbox")
+	}
+
+	if err := r.Send(context.Background(), 7); err != actor.ErrChannelClosed {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrChannelClosed, err)
+	}
+
+	// messages enqueued before Close are received
+	if n, err := r.Receive(context.Background(), buf); n != 1 || err != nil {
+		t.Fatalf("expecting: 1 message, receiving: %d, %v", n, err)
+	}
+
+	if _, err := r.Receive(context.Background(), buf); err != actor.ErrChannelClosed {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrChannelClosed, err)
+	}
+}
+
+func TestRingMailboxBlockedSend(t *testing.T) {
+	r := actor.NewRingMailbox[int](1)
+	if r.Cap() != 2 || !r.Push(0) || !r.Push(1) || r.Push(2) {
+		t.Fatalf("expecting: full mailbox of capacity 2, receiving: %d", r.Cap())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := r.Send(ctx, 2); err != context.DeadlineExceeded {
+		t.Fatalf("expecting: %v, receiving: %v", context.DeadlineExceeded, err)
+	}
+
+	sent := make(chan error, 2)
+	for idx := 2; idx <= 3; idx++ {
+		go func(v int) { sent <- r.Send(context.Background(), v) }(idx)
+	}
+
+	buf := make([]int, 1)
+
+	// each received message releases a parked Send
+	for received := 0; received < 4; received++ {
+		if n, err := r.Receive(context.Background(), buf); n != 1 || err != nil {
+			t.Fatalf("expecting: 1 message, receiving: %d, %v", n, err)
+		}
+	}
+
+	for idx := 0; idx < 2; idx++ {
+		if err := <-sent; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRingMailboxBlockedSenders(t *testing.T) {
+	const senders, messages = 16, 200
+
+	r := actor.NewRingMailbox[[2]int](2)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for p := 0; p < senders; p++ {
+		wg.Add(1)
+
+		go func(p int) {
+			defer wg.Done()
+
+			for idx := 0; idx < messages; idx++ {
+				if err := r.Send(ctx, [2]int{p, idx}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	// senders are parked on full mailbox while consumer dequeues one by one
+	received := make([][]int, senders)
+	buf := make([][2]int, 1)
+
+	for total := 0; total < senders*messages; {
+		rctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		n, err := r.Receive(rctx, buf)
+		cancel()
+
+		if err != nil {
+			t.Fatalf("lost message after %d received: %v", total, err)
+		}
+
+		for _, m := range buf[:n] {
+			received[m[0]] = append(received[m[0]], m[1])
+		}
+
+		total += n
+	}
+
+	wg.Wait()
+
+	for p, msgs := range received {
+		for idx, m := range msgs {
+			if m != idx {
+				t.Fatalf("sender %d expecting: %d, receiving: %d", p, idx, m)
+			}
+		}
+
+		if len(msgs) != messages {
+			t.Fatalf("sender %d expecting: %d messages, receiving: %d", p, messages, len(msgs))
+		}
+	}
+}
+
+func TestRingMailboxProducers(t *testing.T) {
+	const producers, messages = 4, 10000
+
+	r := actor.NewRingMailbox[[2]int](64)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+
+		go func(p int) {
+			defer wg.Done()
+
+			for idx := 0; idx < messages; idx++ {
+				if err := r.Send(ctx, [2]int{p, idx}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	next := make([]int, producers)
+	buf := make([][2]int, 16)
+
+	for received := 0; received < producers*messages; {
+		n, err := r.Receive(ctx, buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, m := range buf[:n] {
+			// messages of a producer are received in send order
+			if m[1] != next[m[0]] {
+				t.Fatalf("expecting: message %d of producer %d, receiving: %d",
+					next[m[0]], m[0], m[1])
+			}
+
+			next[m[0]]++
+		}
+
+		received += n
+	}
+
+	wg.Wait()
+}
+
+func TestRingMailboxActor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const messages = 1000
+	done := make(chan int, 1)
+
+	tc := createTestCase(1, 100, -1)[0]
+	act, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) {
+			buf := make([]interface{}, 32)
+			sum := 0
+
+			for {
+				n := act.ReceiveBatch(buf)
+				if n == 0 {
+					return
+				}
+
+				for _, msg := range buf[:n] {
+					sum += msg.(int)
+				}
+
+				if sum == messages*(messages-1)/2 {
+					done <- sum
+				}
+			}
+		},
+		tc.backup,
+		actor.WithRingMailbox(),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != actor.ErrRingReceive {
+				t.Fatalf("expecting: panic %v, receiving: %v", actor.ErrRingReceive, r)
+			}
+		}()
+
+		act.Receive()
+	}()
+
+	if s, _ := actor.Stats(tc.name); s.MailboxCapacity != 128 {
+		t.Fatalf("expecting: capacity 128, receiving: %d", s.MailboxCapacity)
+	}
+
+	for idx := 0; idx < messages; idx++ {
+		if err := act.Send(idx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	cancel()
+	waitDeregister(t, tc.name)
+
+	if err := act.Send(0); err != actor.ErrChannelClosed {
+		t.Fatalf("expecting: %v, receiving: %v", actor.ErrChannelClosed, err)
+	}
+}
+
+func TestReceiveBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := make(chan struct{})
+	batches := make(chan int, 1)
+
+	tc := createTestCase(1, 8, -1)[0]
+	act, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) {
+			<-start
+			batches <- act.ReceiveBatch(make([]interface{}, 4))
+			<-act.Done()
+		},
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	for idx := 0; idx < 6; idx++ {
+		act.Send(idx)
+	}
+
+	close(start)
+
+	select {
+	case n := <-batches:
+		if n != 4 {
+			t.Fatalf("expecting: 4 messages, receiving: %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+}
+
+// benchmarkMailbox sends b.N messages by parallel producers, received by a
+// single consumer
+func benchmarkMailbox(
+	b *testing.B,
+	send func(int),
+	receive func() int,
+) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for received := 0; received < b.N; {
+			received += receive()
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for v := 0; pb.Next(); v++ {
+			send(v)
+		}
+	})
+
+	<-done
+}
+
+func BenchmarkChannelMailbox(b *testing.B) {
+	ch := make(chan interface{}, 1024)
+
+	benchmarkMailbox(
+		b,
+		func(v int) { ch <- v },
+		func() int {
+			<-ch
+			return 1
+		},
+	)
+}
+
+func BenchmarkRingMailbox(b *testing.B) {
+	r := actor.NewRingMailbox[interface{}](1024)
+	ctx := context.Background()
+	buf := make([]interface{}, 64)
+
+	benchmarkMailbox(
+		b,
+		func(v int) { r.Send(ctx, v) },
+		func() int {
+			n, _ := r.Receive(ctx, buf)
+			return n
+		},
+	)
+}
+
+func BenchmarkTypedRingMailbox(b *testing.B) {
+	r := actor.NewRingMailbox[int](1024)
+	ctx := context.Background()
+	buf := make([]int, 64)
+
+	benchmarkMailbox(
+		b,
+		func(v int) { r.Send(ctx, v) },
+		func() int {
+			n, _ := r.Receive(ctx, buf)
+			return n
+		},
+	)
+}
+
+func benchmarkActorSend(b *testing.B, opts ...actor.Option) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	tc := createTestCase(1, 1024, -1)[0]
+
+	act, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) {
+			defer close(done)
+
+			buf := make([]interface{}, 64)
+			for received := 0; received < b.N; {
+				received += act.ReceiveBatch(buf)
+			}
+		},
+		tc.backup,
+		opts...,
+	)
+	if err != nil {
+		b.Fatal(createActorErr)
+	}
+
+	msg := &struct{}{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			act.Send(msg)
+		}
+	})
+
+	<-done
+}
+
+func BenchmarkActorSendChannel(b *testing.B) {
+	benchmarkActorSend(b)
+}
+
+func BenchmarkActorSendRing(b *testing.B) {
+	benchmarkActorSend(b, actor.WithRingMailbox())
+}
@@ -77,12 +77,14 @@ func (r *registeredActor) register(actor Actor) error {
 	r.nameUUID[actor.Name()] = actor.UUID()
 	r.uuidActor[actor.UUID()] = actor
 
-	GetLog().Info(
-		"actor registered",
-		zap.String("service", serviceName),
-		zap.String("actor", actor.Name()),
-		zap.String("uuid", actor.UUID()),
-	)
+	if logEvent(LogRegistration) {
+		GetLog().Info(
+			"actor registered",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.Name()),
+			zap.String("uuid", actor.UUID()),
+		)
+	}
 
 	return nil
 }
@@ -106,12 +108,14 @@ func (r *registeredActor) deregister(actor Actor) error {
 	delete(r.uuidActor, actor.UUID())
 	delete(r.nameUUID, actor.Name())
 
-	GetLog().Info(
-		"actor deregistered",
-		zap.String("service", serviceName),
-		zap.String("actor", actor.Name()),
-		zap.String("uuid", actor.UUID()),
-	)
+	if logEvent(LogRegistration) {
+		GetLog().Info(
+			"actor deregistered",
+			zap.String("service", serviceName),
+			zap.String("actor", actor.Name()),
+			zap.String("uuid", actor.UUID()),
+		)
+	}
 
 	return nil
 }
@@ -122,13 +126,15 @@ func (r *registeredActor) getByName(name string) (Actor, error) {
 
 	if uuid, ok := r.nameUUID[name]; ok {
 		if actor, ok := r.uuidActor[uuid]; ok {
-			GetLog().Info(
-				"get actor by name",
-				zap.String("service", serviceName),
-				zap.String("actor", name),
-				zap.String("uuid", uuid),
-				zap.String("message", "actor retrieved"),
-			)
+			if logEvent(LogLookup) {
+				GetLog().Info(
+					"get actor by name",
+					zap.String("service", serviceName),
+					zap.String("actor", name),
+					zap.String("uuid", uuid),
+					zap.String("message", "actor retrieved"),
+				)
+			}
 
 			return actor, nil
 		}
@@ -149,12 +155,14 @@ func (r *registeredActor) getByUUID(uuid string) (Actor, error) {
 	r.rwLock.RLock()
 
 	if actor, ok := r.uuidActor[uuid]; ok {
-		GetLog().Info(
-			"get actor by uuid",
-			zap.String("service", serviceName),
-			zap.String("uuid", uuid),
-			zap.String("message", "actor retrieved"),
-		)
+		if logEvent(LogLookup) {
+			GetLog().Info(
+				"get actor by uuid",
+				zap.String("service", serviceName),
+				zap.String("uuid", uuid),
+				zap.String("message", "actor retrieved"),
+			)
+		}
 
 		return actor, nil
 	}
@@ -0,0 +1,219 @@
+// +build database
+
+package actor_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vsdmars/actor"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type snapshotState struct {
+	Count int
+	Names []string
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, tc := range createTestCase(1, 0, 0) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		handle := func(act actor.Actor) { <-act.Done() }
+
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			handle,
+			tc.backup,
+			actor.WithSnapshotRetention(2),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		var state snapshotState
+		if err := act.LoadLatestSnapshot(&state); err != actor.ErrSnapshotNotFound {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrSnapshotNotFound, err)
+		}
+
+		for idx := 1; idx <= 5; idx++ {
+			state.Count = idx
+			state.Names = append(state.Names, tc.name)
+
+			if err := act.SaveSnapshot(state); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var restored snapshotState
+		if err := act.LoadLatestSnapshot(&restored); err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Count != 5 || len(restored.Names) != 5 {
+			t.Errorf("expecting count: 5, receiving: %d", restored.Count)
+		}
+
+		cancel()
+		waitDeregister(t, tc.name)
+
+		// restarted actor recovers from previous instance's snapshot
+		act, err = actor.NewActor(
+			context.Background(),
+			tc.name,
+			tc.buffer,
+			handle,
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		restored = snapshotState{}
+		if err := act.LoadLatestSnapshot(&restored); err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Count != 5 {
+			t.Errorf("expecting count: 5, receiving: %d", restored.Count)
+		}
+
+		gobAct, err := actor.NewActor(
+			context.Background(),
+			tc.name+"_gob",
+			tc.buffer,
+			handle,
+			tc.backup,
+			actor.WithCodec(actor.GobCodec{}),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if err := gobAct.SaveSnapshot(state); err != nil {
+			t.Fatal(err)
+		}
+
+		restored = snapshotState{}
+		if err := gobAct.LoadLatestSnapshot(&restored); err != nil {
+			t.Fatal(err)
+		}
+
+		if restored.Count != 5 {
+			t.Errorf("expecting count: 5, receiving: %d", restored.Count)
+		}
+	}
+}
+
+func TestSnapshotBackupDisabled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, tc := range createTestCase(1, 0, -1) {
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if err := act.SaveSnapshot(1); err != actor.ErrBackupDisabled {
+			t.Errorf("expecting: %v, receiving: %v", actor.ErrBackupDisabled, err)
+		}
+	}
+}
+
+func TestSnapshotRetentionAcrossInstances(t *testing.T) {
+	dir, err := ioutil.TempDir("", "actor_snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	actor.SetBackupConfig(actor.BackupConfig{Dir: dir})
+	defer actor.SetBackupConfig(actor.BackupConfig{})
+
+	tc := createTestCase(1, 0, 0)[0]
+
+	// actor name is a prefix of the other actor's name
+	other, err := actor.NewActor(
+		context.Background(),
+		tc.name+"_other",
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if err := other.SaveSnapshot(snapshotState{Count: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	for instance := 1; instance <= 2; instance++ {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		act, err := actor.NewActor(
+			ctx,
+			tc.name,
+			tc.buffer,
+			func(act actor.Actor) { <-act.Done() },
+			tc.backup,
+			actor.WithSnapshotRetention(2),
+		)
+		if err != nil {
+			t.Fatal(createActorErr)
+		}
+
+		if instance == 1 {
+			var state snapshotState
+			if err := act.LoadLatestSnapshot(&state); err != actor.ErrSnapshotNotFound {
+				t.Errorf("expecting: %v, receiving: %v", actor.ErrSnapshotNotFound, err)
+			}
+		}
+
+		for idx := 1; idx <= 3; idx++ {
+			if err := act.SaveSnapshot(snapshotState{Count: instance*10 + idx}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		cancel()
+		waitDeregister(t, tc.name)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "sqlitedb", tc.name+"_*.db"))
+
+	total := 0
+	for _, file := range files {
+		db, err := sqlx.Open("sqlite3", file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var count int
+		err = db.Get(&count, "SELECT COUNT(*) FROM snapshot ;")
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		total += count
+	}
+
+	// 2 latest snapshots across instances, and the other actor's snapshot
+	if total != 3 {
+		t.Errorf("expecting: 3 snapshots, receiving: %d", total)
+	}
+}
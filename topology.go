@@ -0,0 +1,274 @@
+package actor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// TopologyNode is an actor within the communication graph
+	TopologyNode struct {
+		Name string `json:"name"`
+		Live bool   `json:"live"` // registered when graph is taken
+	}
+
+	// TopologyEdge is observed communication from sender to receiver
+	TopologyEdge struct {
+		From  string `json:"from"`
+		To    string `json:"to"`
+		Count uint64 `json:"count"` // messages sent
+	}
+
+	// SupervisionEdge is parent set by WithParent supervising child
+	SupervisionEdge struct {
+		Parent string `json:"parent"`
+		Child  string `json:"child"`
+	}
+
+	// TopologyGraph is the live communication graph of actors
+	TopologyGraph struct {
+		Nodes       []TopologyNode    `json:"nodes"`       // ordered by name
+		Edges       []TopologyEdge    `json:"edges"`       // ordered by sender, receiver
+		Supervision []SupervisionEdge `json:"supervision"` // ordered by parent, child
+	}
+
+	senderKey struct{}
+
+	edgeKey struct {
+		from string
+		to   string
+	}
+
+	// handlerSlot is the actor whose handler runs on a goroutine
+	handlerSlot struct {
+		name atomic.Value // string, empty: no handler running
+	}
+)
+
+var (
+	// observed edges, edgeKey -> *uint64 message count
+	edges sync.Map
+	// 1: plain Send observes sender by handler goroutine
+	senderTracking int32
+	// goroutine id -> *handlerSlot of goroutines running handlers
+	handlers sync.Map
+)
+
+// Topology returns the communication graph observed since start or
+// ResetTopology, along with supervision hierarchy of registered actors
+//
+// An edge is observed when a handler forwards the received *Envelope by
+// Send, sends with the context passed to ReceiveFunc or returned by
+// Envelope.Context or Envelope.Handle by SendContext, and when outbox relay
+// delivers messages. Sender of other messages sent by handlers is observed
+// if SetSenderTracking is enabled, unknown otherwise.
+func Topology() TopologyGraph {
+	g := TopologyGraph{
+		Nodes:       make([]TopologyNode, 0),
+		Edges:       make([]TopologyEdge, 0),
+		Supervision: make([]SupervisionEdge, 0),
+	}
+
+	live := make(map[string]bool)
+	for _, s := range Snapshot().Actors {
+		live[s.Name] = true
+
+		if s.Parent != "" {
+			g.Supervision = append(g.Supervision, SupervisionEdge{s.Parent, s.Name})
+		}
+	}
+
+	names := make(map[string]bool)
+	for name := range live {
+		names[name] = true
+	}
+
+	edges.Range(func(k, v interface{}) bool {
+		key := k.(edgeKey)
+		names[key.from], names[key.to] = true, true
+
+		g.Edges = append(g.Edges, TopologyEdge{
+			From:  key.from,
+			To:    key.to,
+			Count: atomic.LoadUint64(v.(*uint64)),
+		})
+
+		return true
+	})
+
+	for _, s := range g.Supervision {
+		names[s.Parent] = true
+	}
+
+	for name := range names {
+		g.Nodes = append(g.Nodes, TopologyNode{Name: name, Live: live[name]})
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Name < g.Nodes[j].Name
+	})
+
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+
+		return g.Edges[i].To < g.Edges[j].To
+	})
+
+	sort.Slice(g.Supervision, func(i, j int) bool {
+		if g.Supervision[i].Parent != g.Supervision[j].Parent {
+			return g.Supervision[i].Parent < g.Supervision[j].Parent
+		}
+
+		return g.Supervision[i].Child < g.Supervision[j].Child
+	})
+
+	return g
+}
+
+// SetSenderTracking enables observing the actor whose handler sends
+// messages without envelope or context carries the sender, e.g. by Send
+//
+// sender is resolved by the goroutine running handler, which costs
+// microseconds per Send, thus it is disabled by default. Messages sent by
+// goroutines started by handlers are not observed.
+func SetSenderTracking(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+
+	atomic.StoreInt32(&senderTracking, v)
+}
+
+// ResetTopology removes observed edges
+func ResetTopology() {
+	edges.Range(func(k, _ interface{}) bool {
+		edges.Delete(k)
+		return true
+	})
+}
+
+// DOT returns graph in Graphviz DOT format
+//
+// communication edges are labelled by message count, supervision edges are
+// dashed, actors not registered are dotted.
+func (g TopologyGraph) DOT() string {
+	var b strings.Builder
+
+	b.WriteString("digraph actors {\n")
+
+	for _, n := range g.Nodes {
+		if n.Live {
+			fmt.Fprintf(&b, "\t%s;\n", strconv.Quote(n.Name))
+		} else {
+			fmt.Fprintf(&b, "\t%s [style=dotted];\n", strconv.Quote(n.Name))
+		}
+	}
+
+	for _, s := range g.Supervision {
+		fmt.Fprintf(&b, "\t%s -> %s [style=dashed, arrowhead=odiamond];\n",
+			strconv.Quote(s.Parent), strconv.Quote(s.Child))
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=\"%d\"];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), e.Count)
+	}
+
+	b.WriteString("}\n")
+
+	return b.String()
+}
+
+// observe counts message sent from sender to receiving actor
+func (actor *localActor) observe(from string) {
+	key := edgeKey{from, actor.name}
+
+	v, ok := edges.Load(key)
+	if !ok {
+		v, _ = edges.LoadOrStore(key, new(uint64))
+	}
+
+	atomic.AddUint64(v.(*uint64), 1)
+}
+
+// withSender returns ctx carries receiving actor of e as sender of
+// messages sent with ctx
+func (e *Envelope) withSender(ctx context.Context) context.Context {
+	if e.actor == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, senderKey{}, e.actor.name)
+}
+
+// withActorSender returns ctx carries name as sender of messages sent with
+// ctx, passed to actor's handler
+func withActorSender(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, senderKey{}, name)
+}
+
+// senderFromContext returns sender carried by ctx, or the actor whose
+// handler runs on current goroutine if sender tracking is enabled, empty:
+// unknown
+func senderFromContext(ctx context.Context) string {
+	if ctx != nil {
+		if sender, ok := ctx.Value(senderKey{}).(string); ok {
+			return sender
+		}
+	}
+
+	if atomic.LoadInt32(&senderTracking) == 0 {
+		return ""
+	}
+
+	if v, ok := handlers.Load(goroutineID()); ok {
+		name, _ := v.(*handlerSlot).name.Load().(string)
+		return name
+	}
+
+	return ""
+}
+
+// trackHandler registers current goroutine running handlers, the slot is
+// released by release
+func trackHandler() *handlerSlot {
+	slot := &handlerSlot{}
+	slot.name.Store("")
+
+	handlers.Store(goroutineID(), slot)
+
+	return slot
+}
+
+// set sets the actor whose handler runs, empty: no handler running
+func (s *handlerSlot) set(name string) {
+	s.name.Store(name)
+}
+
+// release unregisters current goroutine
+func (s *handlerSlot) release() {
+	handlers.Delete(goroutineID())
+}
+
+// goroutineID returns id of current goroutine
+func goroutineID() uint64 {
+	var buf [64]byte
+
+	b := bytes.TrimPrefix(buf[:runtime.Stack(buf[:], false)], []byte("goroutine "))
+	if idx := bytes.IndexByte(b, ' '); idx > 0 {
+		b = b[:idx]
+	}
+
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
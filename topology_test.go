@@ -0,0 +1,284 @@
+package actor_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+// observedPipeline returns pipe1 -> pipe2 -> logger pipeline, forwarding
+// actors signal sent after Send returns
+func observedPipeline(
+	t *testing.T,
+	ctx context.Context,
+) (actor.Actor, actor.Actor, <-chan struct{}) {
+	cases := createTestCase(3, 0, -1)
+	sent := make(chan struct{}, 2)
+
+	logger, err := actor.NewActor(
+		ctx,
+		cases[2].name,
+		cases[2].buffer,
+		func(act actor.Actor) {
+			<-act.Receive()
+			<-act.Done()
+		},
+		cases[2].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe2, err := actor.NewActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			ctx, end := env.Handle()
+			logger.SendContext(ctx, env.Message)
+			end()
+			sent <- struct{}{}
+			<-act.Done()
+		},
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe1, err := actor.NewActor(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(act actor.Actor) {
+			pipe2.Send(<-act.Receive())
+			sent <- struct{}{}
+			<-act.Done()
+		},
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	return pipe1, pipe2, sent
+}
+
+func TestTopology(t *testing.T) {
+	actor.ResetTopology()
+	defer actor.ResetTopology()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pipe1, pipe2, sent := observedPipeline(t, ctx)
+
+	tc := createTestCase(1, 0, -1)[0]
+	child, err := actor.NewActor(
+		ctx,
+		tc.name,
+		tc.buffer,
+		func(act actor.Actor) { <-act.Done() },
+		tc.backup,
+		actor.WithParent(pipe1),
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if err := pipe1.Send(actor.NewEnvelope("hop")); err != nil {
+		t.Fatal(err)
+	}
+
+	// edge is observed once Send returns
+	for idx := 0; idx < 2; idx++ {
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+
+	g := actor.Topology()
+
+	var logger string
+	counts := make(map[[2]string]uint64)
+	for _, e := range g.Edges {
+		counts[[2]string{e.From, e.To}] = e.Count
+
+		if e.From == pipe2.Name() {
+			logger = e.To
+		}
+	}
+
+	if counts[[2]string{pipe1.Name(), pipe2.Name()}] != 1 || logger == "" {
+		t.Fatalf("expecting: pipe1 -> pipe2 -> logger, receiving: %+v", g.Edges)
+	}
+
+	supervised := false
+	for _, s := range g.Supervision {
+		if s.Parent == pipe1.Name() && s.Child == child.Name() {
+			supervised = true
+		}
+	}
+
+	if !supervised {
+		t.Fatalf("expecting: %s supervises %s, receiving: %+v",
+			pipe1.Name(), child.Name(), g.Supervision)
+	}
+
+	dot := g.DOT()
+	for _, line := range []string{
+		"digraph actors {",
+		strconv.Quote(pipe1.Name()) + " -> " + strconv.Quote(pipe2.Name()) +
+			` [label="1"];`,
+		strconv.Quote(pipe2.Name()) + " -> " + strconv.Quote(logger) +
+			` [label="1"];`,
+		strconv.Quote(pipe1.Name()) + " -> " + strconv.Quote(child.Name()) +
+			" [style=dashed",
+	} {
+		if !strings.Contains(dot, line) {
+			t.Fatalf("expecting: %q in\n%s", line, dot)
+		}
+	}
+
+	b, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded actor.TopologyGraph
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.Edges) != len(g.Edges) || len(decoded.Nodes) != len(g.Nodes) {
+		t.Fatalf("expecting: %+v, receiving: %+v", g, decoded)
+	}
+}
+
+func TestTopologyPlainSend(t *testing.T) {
+	actor.ResetTopology()
+	defer actor.ResetTopology()
+
+	actor.SetSenderTracking(true)
+	defer actor.SetSenderTracking(false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(4, 0, -1)
+	sent := make(chan struct{}, 3)
+
+	logger, err := actor.NewActor(
+		ctx,
+		cases[3].name,
+		cases[3].buffer,
+		func(act actor.Actor) {
+			<-act.Receive()
+			<-act.Receive()
+			<-act.Done()
+		},
+		cases[3].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	// sends with ReceiveFunc's context
+	spawned, err := actor.Spawn(
+		ctx,
+		cases[2].name,
+		1,
+		func(ctx context.Context, msg interface{}) {
+			logger.SendContext(ctx, msg)
+			sent <- struct{}{}
+		},
+		cases[2].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe2, err := actor.NewActor(
+		ctx,
+		cases[1].name,
+		cases[1].buffer,
+		func(act actor.Actor) {
+			logger.Send(<-act.Receive())
+			sent <- struct{}{}
+			<-act.Done()
+		},
+		cases[1].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe1, err := actor.NewActor(
+		ctx,
+		cases[0].name,
+		cases[0].buffer,
+		func(act actor.Actor) {
+			pipe2.Send(<-act.Receive())
+			sent <- struct{}{}
+			<-act.Done()
+		},
+		cases[0].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	// plain message sent by caller has no sender
+	if err := pipe1.Send("hop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := spawned.Send("hop"); err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := 0; idx < 3; idx++ {
+		select {
+		case <-sent:
+		case <-time.After(5 * time.Second):
+			t.Fatal(actorTimeoutErr)
+		}
+	}
+
+	expect := []actor.TopologyEdge{
+		{From: pipe1.Name(), To: pipe2.Name(), Count: 1},
+		{From: pipe2.Name(), To: logger.Name(), Count: 1},
+		{From: spawned.Name(), To: logger.Name(), Count: 1},
+	}
+
+	g := actor.Topology()
+	if len(g.Edges) != len(expect) {
+		t.Fatalf("expecting: %+v, receiving: %+v", expect, g.Edges)
+	}
+
+	for _, e := range expect {
+		found := false
+		for _, got := range g.Edges {
+			if got == e {
+				found = true
+			}
+		}
+
+		if !found {
+			t.Fatalf("expecting: %+v in %+v", e, g.Edges)
+		}
+	}
+
+	if dot := g.DOT(); !strings.Contains(dot, strconv.Quote(pipe1.Name())+" -> "+
+		strconv.Quote(pipe2.Name())+` [label="1"];`) {
+		t.Fatalf("expecting: pipe1 -> pipe2 in\n%s", dot)
+	}
+}
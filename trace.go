@@ -0,0 +1,330 @@
+package actor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C trace context header
+// https://www.w3.org/TR/trace-context/#traceparent-header
+const traceparentHeader = "traceparent"
+
+// span names
+const (
+	SpanSend    = "send"    // sender delivers message into mailbox
+	SpanMailbox = "mailbox" // message waits in mailbox
+	SpanHandle  = "handle"  // handler processes message
+)
+
+// ErrTraceParent traceparent is malformed
+var ErrTraceParent = errors.New("traceparent format error")
+
+type (
+	// TraceID identifies a trace
+	TraceID [16]byte
+
+	// SpanID identifies a span
+	SpanID [8]byte
+
+	// SpanContext identifies a span within a trace
+	SpanContext struct {
+		TraceID TraceID
+		SpanID  SpanID
+	}
+
+	// Span is a finished span
+	Span struct {
+		Name string // SpanSend, SpanMailbox or SpanHandle
+		SpanContext
+		Parent    SpanID // zero: root span
+		Actor     string // receiving actor name
+		UUID      string // receiving actor uuid
+		MessageID string // envelope id
+		Start     time.Time
+		End       time.Time
+	}
+
+	// SpanExporter exports finished spans
+	//
+	// ExportSpan is called on the message path, it must not block.
+	SpanExporter interface {
+		ExportSpan(Span)
+	}
+
+	// MemoryExporter keeps exported spans in memory, meant for tests
+	MemoryExporter struct {
+		lock  sync.Mutex
+		spans []Span
+	}
+
+	// TraceContext is Propagator propagates span context in W3C
+	// traceparent header, registered by default
+	TraceContext struct{}
+
+	spanKey struct{}
+)
+
+var (
+	tracerLock sync.RWMutex
+	exporter   SpanExporter
+)
+
+// SetSpanExporter enables tracing of messages sent in *Envelope
+//
+// spans are created for Send/SendContext, mailbox wait and handler
+// processing measured by Envelope.Handle. nil disables tracing.
+func SetSpanExporter(e SpanExporter) {
+	defer tracerLock.Unlock()
+	tracerLock.Lock()
+
+	exporter = e
+}
+
+func getSpanExporter() SpanExporter {
+	defer tracerLock.RUnlock()
+	tracerLock.RLock()
+
+	return exporter
+}
+
+// ContextWithSpan returns context carries span context
+func ContextWithSpan(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// SpanFromContext returns span context carried by ctx
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// IsValid reports whether span context has trace id and span id
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// TraceParent returns span context in W3C traceparent format
+func (sc SpanContext) TraceParent() string {
+	return fmt.Sprintf(
+		"00-%s-%s-01",
+		hex.EncodeToString(sc.TraceID[:]),
+		hex.EncodeToString(sc.SpanID[:]),
+	)
+}
+
+// ParseTraceParent parses W3C traceparent
+func ParseTraceParent(v string) (SpanContext, error) {
+	var sc SpanContext
+
+	parts := strings.Split(v, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrTraceParent
+	}
+
+	tid, err := hex.DecodeString(parts[1])
+	if err != nil || len(tid) != len(sc.TraceID) {
+		return sc, ErrTraceParent
+	}
+
+	sid, err := hex.DecodeString(parts[2])
+	if err != nil || len(sid) != len(sc.SpanID) {
+		return sc, ErrTraceParent
+	}
+
+	copy(sc.TraceID[:], tid)
+	copy(sc.SpanID[:], sid)
+
+	if !sc.IsValid() {
+		return sc, ErrTraceParent
+	}
+
+	return sc, nil
+}
+
+// childSpan returns a new span context within parent's trace, starts a new
+// trace if parent is invalid
+func childSpan(parent SpanContext) SpanContext {
+	var b [24]byte
+	rand.Read(b[:])
+
+	sc := SpanContext{TraceID: parent.TraceID}
+	if !parent.IsValid() {
+		copy(sc.TraceID[:], b[:16])
+	}
+
+	copy(sc.SpanID[:], b[16:])
+
+	return sc
+}
+
+// Inject writes span context of ctx into traceparent header
+func (TraceContext) Inject(ctx context.Context, h Header) {
+	if sc, ok := SpanFromContext(ctx); ok && sc.IsValid() {
+		h[traceparentHeader] = sc.TraceParent()
+	}
+}
+
+// Extract returns ctx carries span context of traceparent header
+func (TraceContext) Extract(ctx context.Context, h Header) context.Context {
+	sc, err := ParseTraceParent(h[traceparentHeader])
+	if err != nil {
+		return ctx
+	}
+
+	return ContextWithSpan(ctx, sc)
+}
+
+// NewMemoryExporter returns empty MemoryExporter
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+// ExportSpan keeps span
+func (m *MemoryExporter) ExportSpan(s Span) {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+
+	m.spans = append(m.spans, s)
+}
+
+// Spans returns exported spans in export order
+func (m *MemoryExporter) Spans() []Span {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+
+	return append([]Span(nil), m.spans...)
+}
+
+// Reset removes exported spans
+func (m *MemoryExporter) Reset() {
+	defer m.lock.Unlock()
+	m.lock.Lock()
+
+	m.spans = nil
+}
+
+// traceSend starts send span of envelope
+//
+// parent span is taken from ctx, or envelope's traceparent header if ctx
+// carries none. returns func exports the span.
+func (actor *localActor) traceSend(
+	ctx context.Context,
+	env *Envelope,
+	exp SpanExporter,
+) func() {
+	var parent SpanContext
+
+	if ctx != nil {
+		parent, _ = SpanFromContext(ctx)
+	}
+
+	if !parent.IsValid() {
+		parent, _ = ParseTraceParent(env.Header[traceparentHeader])
+	}
+
+	sc := childSpan(parent)
+
+	// sender's header is not modified
+	header := make(Header, len(env.Header)+1)
+	for k, v := range env.Header {
+		header[k] = v
+	}
+
+	header[traceparentHeader] = sc.TraceParent()
+	env.Header = header
+	env.span = sc
+
+	start := time.Now()
+
+	return func() {
+		exp.ExportSpan(Span{
+			Name:        SpanSend,
+			SpanContext: sc,
+			Parent:      parent.SpanID,
+			Actor:       actor.name,
+			UUID:        actor.uuid,
+			MessageID:   env.ID,
+			Start:       start,
+			End:         time.Now(),
+		})
+	}
+}
+
+// Handle marks message is taken from mailbox by handler
+//
+// returns message context carries handler span, forward messages with
+// SendContext(ctx, ...) to link spans across actors, and func called once
+// message is processed. Message id and path of the envelope are reported if
+// handler panics before func is called. Mailbox wait and handler processing
+// spans are exported if tracing is enabled by SetSpanExporter, handler
+// latency of actor reads messages by Receive or ReceiveBatch is recorded if
+// metrics are enabled by SetMetrics.
+func (e *Envelope) Handle() (context.Context, func()) {
+	ctx := e.Context()
+
+	done := func() {}
+
+	if e.actor != nil {
+		// reported if handler panics
+		e.actor.handling.Store(e)
+		done = func() { e.actor.handling.Store((*Envelope)(nil)) }
+
+		// received messages are counted by actor, latency is measured by
+		// receive loop of actors created by Spawn or NewBehaviorActor
+		if m := getMetrics(); m != nil && !e.actor.measured {
+			name, start := e.actor.name, time.Now()
+			e.actor.recordReceived(m)
+
+			done = func() {
+				e.actor.handling.Store((*Envelope)(nil))
+				m.Observe(MetricHandleLatency, name, time.Since(start).Seconds())
+			}
+		}
+	}
+
+	exp := getSpanExporter()
+	if exp == nil || !e.span.IsValid() {
+		return ctx, done
+	}
+
+	now := time.Now()
+	name, uuid := "", ""
+	if e.actor != nil {
+		name, uuid = e.actor.name, e.actor.uuid
+	}
+
+	wait := childSpan(e.span)
+	exp.ExportSpan(Span{
+		Name:        SpanMailbox,
+		SpanContext: wait,
+		Parent:      e.span.SpanID,
+		Actor:       name,
+		UUID:        uuid,
+		MessageID:   e.ID,
+		Start:       e.sent,
+		End:         now,
+	})
+
+	handle := childSpan(e.span)
+
+	return ContextWithSpan(ctx, handle), func() {
+		done()
+
+		exp.ExportSpan(Span{
+			Name:        SpanHandle,
+			SpanContext: handle,
+			Parent:      e.span.SpanID,
+			Actor:       name,
+			UUID:        uuid,
+			MessageID:   e.ID,
+			Start:       now,
+			End:         time.Now(),
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package actor_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vsdmars/actor"
+)
+
+func TestTracePipeline(t *testing.T) {
+	exp := actor.NewMemoryExporter()
+	actor.SetSpanExporter(exp)
+	defer actor.SetSpanExporter(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cases := createTestCase(3, 0, -1)
+	done := make(chan struct{})
+
+	// pipe1 -> pipe2 -> logger
+	logger, err := actor.NewActor(
+		ctx,
+		cases[2].name,
+		cases[2].buffer,
+		func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			_, end := env.Handle()
+			end()
+			close(done)
+			<-act.Done()
+		},
+		cases[2].backup,
+	)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	forward := func(next actor.Actor) actor.HandleType {
+		return func(act actor.Actor) {
+			env := (<-act.Receive()).(*actor.Envelope)
+			ctx, end := env.Handle()
+			next.SendContext(ctx, env.Message)
+			end()
+			<-act.Done()
+		}
+	}
+
+	pipe2, err := actor.NewActor(
+		ctx, cases[1].name, cases[1].buffer, forward(logger), cases[1].backup)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	pipe1, err := actor.NewActor(
+		ctx, cases[0].name, cases[0].buffer, forward(pipe2), cases[0].backup)
+	if err != nil {
+		t.Fatal(createActorErr)
+	}
+
+	if err := pipe1.SendContext(ctx, "traced"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal(actorTimeoutErr)
+	}
+
+	// handle span of pipe1 and pipe2 ends after forwarding
+	var spans []actor.Span
+	for idx := 0; idx < 100 && len(spans) < 9; idx++ {
+		time.Sleep(10 * time.Millisecond)
+		spans = exp.Spans()
+	}
+
+	if len(spans) != 9 {
+		t.Fatalf("expecting: 9 spans, receiving: %d", len(spans))
+	}
+
+	ids := make(map[actor.SpanID]actor.Span)
+	count := make(map[string]int)
+
+	for _, s := range spans {
+		if s.TraceID != spans[0].TraceID {
+			t.Errorf("expecting single trace, receiving: %v", s.TraceID)
+		}
+
+		ids[s.SpanID] = s
+		count[s.Name]++
+	}
+
+	for _, name := range []string{actor.SpanSend, actor.SpanMailbox, actor.SpanHandle} {
+		if count[name] != 3 {
+			t.Errorf("expecting: 3 %s spans, receiving: %d", name, count[name])
+		}
+	}
+
+	// send spans to pipe2 and logger are children of the previous handle span
+	for _, s := range spans {
+		if s.Name == actor.SpanSend && s.Actor != cases[0].name {
+			if p, ok := ids[s.Parent]; !ok || p.Name != actor.SpanHandle {
+				t.Errorf("expecting %s send span child of handle span", s.Actor)
+			}
+		}
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	v := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := actor.ParseTraceParent(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sc.TraceParent() != v {
+		t.Errorf("expecting: %s, receiving: %s", v, sc.TraceParent())
+	}
+
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6-00f067aa0ba902b7-01",
+	} {
+		if _, err := actor.ParseTraceParent(bad); err != actor.ErrTraceParent {
+			t.Errorf("expecting: %v for %q, receiving: %v", actor.ErrTraceParent, bad, err)
+		}
+	}
+
+	ctx := actor.ContextWithSpan(context.Background(), sc)
+	h := actor.InjectContext(ctx, nil)
+
+	remote, cancel := actor.ExtractContext(context.Background(), h)
+	defer cancel()
+
+	if got, _ := actor.SpanFromContext(remote); got != sc {
+		t.Errorf("expecting: %v, receiving: %v", sc, got)
+	}
+}
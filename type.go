@@ -3,9 +3,8 @@ package actor
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	idb "github.com/vsdmars/actor/internal/db"
 )
 
 type (
@@ -15,7 +14,9 @@ type (
 	}
 
 	backup struct {
-		db idb.DB
+		store   BackupStore
+		batch   *batchWriter // nil: backup without batch
+		mailbox MailboxStore // nil: mailbox is not durable
 	}
 
 	channels struct {
@@ -24,6 +25,7 @@ type (
 	}
 
 	timing struct {
+		stampLock sync.RWMutex // guards startTime and endTime
 		startTime time.Time
 		endTime   time.Time
 		timer     *time.Timer // clean up by .Stop it
@@ -41,6 +43,18 @@ type (
 		timing
 		channels
 		backup
+		options
+		dispatch
+		actorLog *actorLogger
+		dedup    *dedup                    // nil: no deduplication
+		relay    *relay                    // nil: no outbox
+		ring     *RingMailbox[interface{}] // nil: channel mailbox
+		// *Envelope processed by handler, set by Envelope.Handle
+		handling atomic.Value
+		// atomic, messages pushed into mailbox, and received messages counted
+		// by recordReceived
+		delivered uint64
+		received  uint64
 	}
 
 	remoteActor struct {
@@ -66,9 +80,17 @@ type (
 		UUID() string
 		Idle() time.Duration
 		Send(message interface{}) error
+		SendContext(ctx context.Context, message interface{}) error
 		Receive() <-chan interface{}
+		ReceiveBatch(buf []interface{}) int
 		Done() <-chan struct{}
 		Backup(string)
+		Flush() error
+		SaveSnapshot(state interface{}) error
+		LoadLatestSnapshot(state interface{}) error
+		DeadLetters() ([]*Envelope, error)
+		Commit(state interface{}, out ...OutboxMessage) error
+		stats() ActorStats
 		close()        // close actor channel
 		resetIdle()    // reset actor idle duration
 		increaseIdle() // increase actor idle duration